@@ -15,4 +15,5 @@ require (
 	github.com/go-test/deep v1.1.0 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
 	github.com/toorop/go-dkim v0.0.0-20201103131630-e1cd1a0a5208 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 )
@@ -7,32 +7,60 @@ import (
 	"html/template"
 	"log"
 	"os"
+	"strings"
 )
 
 const (
-	defaultPort string = "8080"
-	KeyUser     string = "user"
+	defaultPort       string = "8080"
+	KeyUser           string = "user"
+	KeyTwoFactorEmail string = "two-factor-email"
+	KeyFlash          string = "flash"
+	KeyExpiredEmail   string = "password-expired-email"
+	KeyOIDCRequest    string = "oidc-request"
+
+	KeyReauthenticationCode string = "reauthentication-code"
+	KeyReauthenticationNext string = "reauthentication-next"
+
+	PermissionApproveRegistrations string = "registrations.approve"
 )
 
 // AppConfig holds the application config
 type AppConfig struct {
-	port             string
-	host             string
-	isTest           bool
-	UseCache         bool
-	TemplateCache    map[string]*template.Template
-	InfoLog          *log.Logger
-	InProduction     bool
-	Session          *scs.SessionManager
-	UserRegistration *user_registration.UserRegistration
+	port               string
+	host               string
+	isTest             bool
+	inviteOnly         bool
+	approvalRequired   bool
+	adminEmails        []string
+	firstUserIsAdmin   bool
+	magicLink          user_registration.MagicLinkMode
+	oidcProviders      []user_registration.OIDCProvider
+	accessTokenKeyFile string
+	accessTokenSecret  string
+	UseCache           bool
+	TemplateCache      map[string]*template.Template
+	InfoLog            *log.Logger
+	InProduction       bool
+	Session            *scs.SessionManager
+	UserRegistration   *user_registration.UserRegistration
+	OIDCClients        []*user_registration.OIDCClient
 }
 
 func NewApp() AppConfig {
 	port := getPort()
+	host := getHost(port)
 	return AppConfig{
-		port:   port,
-		host:   getHost(port),
-		isTest: isTest(),
+		port:               port,
+		host:               host,
+		isTest:             isTest(),
+		inviteOnly:         os.Getenv("INVITE_ONLY") == "true",
+		approvalRequired:   os.Getenv("APPROVAL_REQUIRED") == "true",
+		adminEmails:        getAdminEmails(),
+		firstUserIsAdmin:   os.Getenv("FIRST_USER_IS_ADMIN") == "true",
+		magicLink:          getMagicLink(),
+		oidcProviders:      getOIDCProviders(host),
+		accessTokenKeyFile: os.Getenv("ACCESS_TOKEN_KEY_FILE"),
+		accessTokenSecret:  os.Getenv("ACCESS_TOKEN_SECRET"),
 	}
 }
 
@@ -60,6 +88,53 @@ func getHost(port string) string {
 	return host
 }
 
+func getAdminEmails() []string {
+	var emails []string
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.TrimSpace(email)
+		if email != "" {
+			emails = append(emails, email)
+		}
+	}
+
+	return emails
+}
+
+func getMagicLink() user_registration.MagicLinkMode {
+	switch os.Getenv("MAGIC_LINK") {
+	case "alongside":
+		return user_registration.MagicLinkAlongsidePassword
+	case "instead":
+		return user_registration.MagicLinkInsteadOfPassword
+	}
+
+	return user_registration.MagicLinkDisabled
+}
+
+// getOIDCProviders reads the providers listed in OIDC_PROVIDERS, e.g. "google,corp", from
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and OIDC_<NAME>_DISPLAY_NAME
+func getOIDCProviders(host string) []user_registration.OIDCProvider {
+	var providers []user_registration.OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, user_registration.OIDCProvider{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  fmt.Sprintf("%s/login/oidc/%s/callback", host, name),
+		})
+	}
+
+	return providers
+}
+
 func isTest() bool {
 	var env = os.Getenv("ENV")
 
@@ -81,3 +156,54 @@ func (a *AppConfig) Host() string {
 func (a *AppConfig) IsTest() bool {
 	return a.isTest
 }
+
+// InviteOnly reports whether public registration is closed, set with INVITE_ONLY=true
+func (a *AppConfig) InviteOnly() bool {
+	return a.inviteOnly
+}
+
+// ApprovalRequired reports whether new users have to be approved by an admin, set with APPROVAL_REQUIRED=true
+func (a *AppConfig) ApprovalRequired() bool {
+	return a.approvalRequired
+}
+
+// AdminEmails returns the addresses of the users that get the admin role, set with a comma separated ADMIN_EMAILS
+func (a *AppConfig) AdminEmails() []string {
+	return a.adminEmails
+}
+
+// FirstUserIsAdmin reports whether the first user to register gets the admin role, set with FIRST_USER_IS_ADMIN=true
+func (a *AppConfig) FirstUserIsAdmin() bool {
+	return a.firstUserIsAdmin
+}
+
+// MagicLink returns whether users can log in with a link sent by e-mail, set with MAGIC_LINK=alongside or MAGIC_LINK=instead
+func (a *AppConfig) MagicLink() user_registration.MagicLinkMode {
+	return a.magicLink
+}
+
+// OIDCProviders returns the OpenID Connect providers to log in with
+func (a *AppConfig) OIDCProviders() []user_registration.OIDCProvider {
+	return a.oidcProviders
+}
+
+// AccessTokenKeyFile returns the path of the PEM encoded PKCS #8 RSA or Ed25519 private key that signs access tokens
+func (a *AppConfig) AccessTokenKeyFile() string {
+	return a.accessTokenKeyFile
+}
+
+// AccessTokenSecret returns the secret that signs access tokens with HS256 when there is no key file
+func (a *AppConfig) AccessTokenSecret() string {
+	return a.accessTokenSecret
+}
+
+// OIDCClient returns the client of the provider with the name, or nil if there is none
+func (a *AppConfig) OIDCClient(name string) *user_registration.OIDCClient {
+	for _, c := range a.OIDCClients {
+		if c.Name() == name {
+			return c
+		}
+	}
+
+	return nil
+}
@@ -58,7 +58,7 @@ func (f *Form) MinLength(field string, length int, r *http.Request) bool {
 
 // IsEmail checks for a valid email address
 func (f *Form) IsEmail(field string) {
-	if !govalidator.IsEmail(f.Get(field)) {
+	if !govalidator.IsEmail(strings.TrimSpace(f.Get(field))) {
 		f.Errors.Add(field, "Invalid email address")
 	}
 }
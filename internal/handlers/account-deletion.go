@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/caselongo/user-registration-go/internal/forms"
+	"github.com/caselongo/user-registration-go/internal/models"
+	"github.com/caselongo/user-registration-go/internal/render"
+	"net/http"
+)
+
+func (m *Repository) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	m.addConfirmationData(r, data, "/account/delete")
+
+	render.RenderTemplate(w, r, "delete-account.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+func (m *Repository) PostDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	data := make(map[string]interface{})
+
+	renderPage := func(form *forms.Form) {
+		render.RenderTemplate(w, r, "delete-account.page.tmpl", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+	}
+
+	hasPassword := m.addConfirmationData(r, data, "/account/delete")
+	if hasPassword {
+		form.Required("password")
+	}
+
+	if !form.Valid() {
+		renderPage(form)
+		return
+	}
+
+	sessionUser, _ := m.sessionUser(r)
+
+	res, err := m.App.UserRegistration.RequestDeletion(r.Context(), sessionUser.Email, m.confirmation(r, hasPassword))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	if !res.OK() {
+		addFieldErrors(form, res)
+
+		renderPage(form)
+		return
+	}
+
+	err = m.App.Session.Destroy(r.Context())
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	m.renderMessage(w, r, fmt.Sprintf("Your account will be deleted on %s. Log in before then to cancel the deletion.", res.User.DeletionScheduledAt.Format("2 January 2006 15:04")), MessageStateSuccess, false)
+}
@@ -0,0 +1,492 @@
+package handlers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"github.com/caselongo/user-registration-go/internal/config"
+	ur "github.com/caselongo/user-registration-go/user-registration"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+const maxAPIRequestSize = 1 << 16
+
+// apiError is the body of every API error response. Errors holds the field errors of a failed validation.
+type apiError struct {
+	Code    string           `json:"code"`
+	Message string           `json:"message"`
+	Errors  []*ur.FieldError `json:"errors,omitempty"`
+}
+
+type apiUser struct {
+	Email            string     `json:"email"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ConfirmedAt      *time.Time `json:"confirmed_at"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	Roles            []string   `json:"roles"`
+}
+
+type apiLoginResponse struct {
+	User              *apiUser `json:"user,omitempty"`
+	TwoFactorRequired bool     `json:"two_factor_required,omitempty"`
+	DeletionCancelled bool     `json:"deletion_cancelled,omitempty"`
+}
+
+func newAPIUser(user *ur.User) *apiUser {
+	roles := user.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+
+	return &apiUser{
+		Email:            user.Address(),
+		CreatedAt:        user.CreatedAt,
+		ConfirmedAt:      user.ConfirmedAt,
+		TwoFactorEnabled: user.TOTPEnabledAt != nil,
+		Roles:            roles,
+	}
+}
+
+// APIOpenAPI serves the OpenAPI document of the API
+func (m *Repository) APIOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPI)
+}
+
+// APIUnsupportedMediaType is the response to API requests that change something without a JSON body
+func (m *Repository) APIUnsupportedMediaType(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "the request must have Content-Type application/json")
+}
+
+func (m *Repository) APINotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "not_found", "no such api endpoint")
+}
+
+func (m *Repository) APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed for this api endpoint")
+}
+
+func (m *Repository) APIRegister(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		ConfirmPassword string `json:"confirm_password"`
+	}
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	res, err := m.App.UserRegistration.Register(r.Context(), req.Email, req.Password, req.ConfirmPassword)
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	if !res.OK() {
+		writeAPIResultError(w, res)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"user": newAPIUser(res.User)})
+}
+
+func (m *Repository) APILogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	res, err := m.App.UserRegistration.Login(r.Context(), req.Email, req.Password)
+	if errors.Is(err, ur.ErrPasswordLoginDisabled) {
+		writeAPIError(w, http.StatusForbidden, "password_login_disabled", err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	if res.TwoFactorRequired {
+		m.App.Session.Put(r.Context(), config.KeyTwoFactorEmail, req.Email)
+
+		writeJSON(w, http.StatusAccepted, apiLoginResponse{TwoFactorRequired: true})
+		return
+	}
+
+	m.apiLogIn(w, r, res)
+}
+
+// APILoginTwoFactor completes a login that returned two_factor_required
+func (m *Repository) APILoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	email := m.App.Session.GetString(r.Context(), config.KeyTwoFactorEmail)
+	if email == "" {
+		writeAPIError(w, http.StatusUnauthorized, "login_required", "log in with e-mail address and password first")
+		return
+	}
+
+	res, err := m.App.UserRegistration.VerifyTwoFactor(r.Context(), email, req.Code)
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	m.apiLogIn(w, r, res)
+}
+
+// apiLogIn starts the session of a successful login, or writes why the login failed
+func (m *Repository) apiLogIn(w http.ResponseWriter, r *http.Request, res *ur.Result) {
+	if !apiLoginOK(w, res) {
+		return
+	}
+
+	err := m.startSession(r, res.User)
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiLoginResponse{
+		User:              newAPIUser(res.User),
+		DeletionCancelled: res.DeletionCancelled,
+	})
+}
+
+// apiLoginOK writes why the login failed and returns false, or returns true for a successful login
+func apiLoginOK(w http.ResponseWriter, res *ur.Result) bool {
+	if res.PasswordExpired {
+		writeAPIError(w, http.StatusForbidden, "password_expired", "your password has expired, change it to log in")
+		return false
+	}
+
+	if !res.OK() {
+		writeAPIResultError(w, res)
+		return false
+	}
+
+	return true
+}
+
+func (m *Repository) APILogout(w http.ResponseWriter, r *http.Request) {
+	err := m.App.Session.Destroy(r.Context())
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Repository) APIConfirm(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	err := m.App.UserRegistration.Confirm(r.Context(), req.Code)
+	switch {
+	case errors.Is(err, ur.ErrConfirmationCodeExpired):
+		writeAPIError(w, http.StatusGone, "code_expired", err.Error())
+	case errors.Is(err, ur.ErrInvalidConfirmationCode):
+		writeAPIError(w, http.StatusBadRequest, "invalid_code", err.Error())
+	case err != nil:
+		writeAPIInternalError(w, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (m *Repository) APIForgot(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	err := m.App.UserRegistration.Forgot(r.Context(), req.Email)
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	// accepted whether the address is known or not
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (m *Repository) APIReset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code            string `json:"code"`
+		Password        string `json:"password"`
+		ConfirmPassword string `json:"confirm_password"`
+	}
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	res, err := m.App.UserRegistration.Reset(r.Context(), req.Code, req.Password, req.ConfirmPassword)
+	if errors.Is(err, ur.ErrInvalidResetCode) {
+		writeAPIError(w, http.StatusBadRequest, "invalid_code", err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	if !res.OK() {
+		writeAPIResultError(w, res)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Repository) APIMe(w http.ResponseWriter, r *http.Request) {
+	// set by BearerAuth for requests with an access token
+	if user, ok := ur.UserFromContext(r.Context()); ok {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"user": newAPIUser(user)})
+		return
+	}
+
+	sessionUser, ok := m.sessionUser(r)
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, "login_required", "not logged in")
+		return
+	}
+
+	user, err := m.App.UserRegistration.ValidateSession(r.Context(), sessionUser)
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	if user == nil {
+		err = m.App.Session.Destroy(r.Context())
+		if err != nil {
+			writeAPIInternalError(w, err)
+			return
+		}
+
+		writeAPIError(w, http.StatusUnauthorized, "login_required", "the session has ended, log in again")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"user": newAPIUser(user)})
+}
+
+// APIToken issues an access token and a refresh token for the e-mail address and password.
+// When two-factor authentication is enabled the code has to be sent along.
+func (m *Repository) APIToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	res, err := m.App.UserRegistration.Login(r.Context(), req.Email, req.Password)
+	if errors.Is(err, ur.ErrPasswordLoginDisabled) {
+		writeAPIError(w, http.StatusForbidden, "password_login_disabled", err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	if res.TwoFactorRequired {
+		if req.Code == "" {
+			writeAPIError(w, http.StatusUnauthorized, "two_factor_required", "send the authentication code along as code")
+			return
+		}
+
+		res, err = m.App.UserRegistration.VerifyTwoFactor(r.Context(), req.Email, req.Code)
+		if err != nil {
+			writeAPIInternalError(w, err)
+			return
+		}
+	}
+
+	if !apiLoginOK(w, res) {
+		return
+	}
+
+	tokens, err := m.App.UserRegistration.IssueTokens(r.Context(), res.User)
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	writeTokens(w, tokens)
+}
+
+// APIRefreshToken exchanges a refresh token for new tokens, the refresh token cannot be used again
+func (m *Repository) APIRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	tokens, err := m.App.UserRegistration.RefreshTokens(r.Context(), req.RefreshToken)
+	switch {
+	case errors.Is(err, ur.ErrRefreshTokenReused):
+		writeAPIError(w, http.StatusUnauthorized, "refresh_token_reused", err.Error())
+	case errors.Is(err, ur.ErrInvalidRefreshToken):
+		writeAPIError(w, http.StatusUnauthorized, "invalid_refresh_token", err.Error())
+	case err != nil:
+		writeAPIInternalError(w, err)
+	default:
+		writeTokens(w, tokens)
+	}
+}
+
+// APIRevokeToken revokes a refresh token and the others of the same login
+func (m *Repository) APIRevokeToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	err := m.App.UserRegistration.RevokeRefreshToken(r.Context(), req.RefreshToken)
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKS publishes the keys that access tokens are verified with
+func (m *Repository) JWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := m.App.UserRegistration.JWKS()
+	if err != nil {
+		writeAPIInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, set)
+}
+
+// APIInvalidAccessToken is the response to requests with an invalid or expired access token
+func (m *Repository) APIInvalidAccessToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	writeAPIError(w, http.StatusUnauthorized, "invalid_access_token", ur.ErrInvalidAccessToken.Error())
+}
+
+// APIInternalError is the response to API requests that failed on the server, the error is logged
+func (m *Repository) APIInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	writeAPIInternalError(w, err)
+}
+
+func writeTokens(w http.ResponseWriter, tokens *ur.TokenPair) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// readJSON decodes the request body into v, or writes a bad request response and returns false
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestSize))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]apiError{"error": {Code: code, Message: message}})
+}
+
+// writeAPIInternalError writes known errors of the user registration with the status that fits them,
+// other errors are logged and answered with a generic message
+func writeAPIInternalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ur.ErrUserNotFound):
+		writeAPIError(w, http.StatusNotFound, "user_not_found", ur.ErrUserNotFound.Error())
+	case errors.Is(err, ur.ErrTwoFactorNotEnabled):
+		writeAPIError(w, http.StatusConflict, "two_factor_not_enabled", ur.ErrTwoFactorNotEnabled.Error())
+	case errors.Is(err, ur.ErrTwoFactorAlreadyEnabled):
+		writeAPIError(w, http.StatusConflict, "two_factor_already_enabled", ur.ErrTwoFactorAlreadyEnabled.Error())
+	case errors.Is(err, ur.ErrTwoFactorEnrollmentNotStarted):
+		writeAPIError(w, http.StatusConflict, "two_factor_enrollment_not_started", ur.ErrTwoFactorEnrollmentNotStarted.Error())
+	default:
+		// other errors may reveal internals, they are only logged
+		log.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", "an internal error occurred, try again later")
+	}
+}
+
+// writeAPIResultError writes the field errors of a failed result, with the status that fits the first error.
+// The field names use underscores, like the properties of the request bodies.
+func writeAPIResultError(w http.ResponseWriter, res *ur.Result) {
+	errs := make([]*ur.FieldError, len(res.Errors))
+	for i, e := range res.Errors {
+		c := *e
+		c.Field = strings.ReplaceAll(c.Field, "-", "_")
+		errs[i] = &c
+	}
+
+	status := http.StatusUnprocessableEntity
+	if len(errs) > 0 {
+		switch errs[0].Code {
+		case ur.CodeInvalidCredentials, ur.CodeInvalidTwoFactorCode:
+			status = http.StatusUnauthorized
+		case ur.CodeNotConfirmed, ur.CodeAwaitingApproval, ur.CodeInvitationRequired:
+			status = http.StatusForbidden
+		case ur.CodeAccountLocked:
+			status = http.StatusLocked
+		case ur.CodeEmailTaken:
+			status = http.StatusConflict
+		}
+	}
+
+	writeJSON(w, status, map[string]apiError{"error": {
+		Code:    "validation_failed",
+		Message: "the request is invalid, see errors",
+		Errors:  errs,
+	}})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/caselongo/user-registration-go/internal/config"
+	"github.com/caselongo/user-registration-go/internal/forms"
+	"github.com/caselongo/user-registration-go/internal/models"
+	"github.com/caselongo/user-registration-go/internal/render"
+	"net/http"
+)
+
+// Approvals lists the registrations awaiting approval
+func (m *Repository) Approvals(w http.ResponseWriter, r *http.Request) {
+	users, err := m.App.UserRegistration.PendingApprovals(r.Context())
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["users"] = users
+
+	render.RenderTemplate(w, r, "approvals.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+func (m *Repository) PostApprove(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	user, err := m.App.UserRegistration.Approve(r.Context(), r.FormValue("email"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), config.KeyFlash, fmt.Sprintf("The registration of %s has been approved.", user.Address()))
+	http.Redirect(w, r, "/admin/approvals", http.StatusSeeOther)
+}
+
+func (m *Repository) PostReject(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	user, err := m.App.UserRegistration.Reject(r.Context(), r.FormValue("email"), r.FormValue("reason"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), config.KeyFlash, fmt.Sprintf("The registration of %s has been rejected.", user.Address()))
+	http.Redirect(w, r, "/admin/approvals", http.StatusSeeOther)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/caselongo/user-registration-go/internal/config"
+	"github.com/caselongo/user-registration-go/internal/forms"
+	"github.com/caselongo/user-registration-go/internal/models"
+	"github.com/caselongo/user-registration-go/internal/render"
+	ur "github.com/caselongo/user-registration-go/user-registration"
+	"github.com/go-chi/chi"
+	"net/http"
+)
+
+func (m *Repository) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	m.addConfirmationData(r, data, "/account/email")
+
+	render.RenderTemplate(w, r, "email.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+func (m *Repository) PostChangeEmail(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	data := make(map[string]interface{})
+
+	renderPage := func(form *forms.Form) {
+		render.RenderTemplate(w, r, "email.page.tmpl", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+	}
+
+	hasPassword := m.addConfirmationData(r, data, "/account/email")
+	if hasPassword {
+		form.Required("password")
+	}
+
+	form.Required("new-email")
+	form.IsEmail("new-email")
+
+	data["new-email"] = r.FormValue("new-email")
+
+	if !form.Valid() {
+		renderPage(form)
+		return
+	}
+
+	sessionUser, _ := m.sessionUser(r)
+
+	res, err := m.App.UserRegistration.ChangeEmail(r.Context(), sessionUser.Email, m.confirmation(r, hasPassword), r.FormValue("new-email"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	if res.OK() {
+		m.App.Session.Remove(r.Context(), config.KeyReauthenticationCode)
+		m.renderMessage(w, r, fmt.Sprintf("A confirmation e-mail will be sent to %s. Your e-mail address is changed once you have confirmed it.", res.User.PendingEmail), MessageStateSuccess, false)
+		return
+	}
+
+	addFieldErrors(form, res)
+
+	renderPage(form)
+}
+
+func (m *Repository) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	user, err := m.App.UserRegistration.ConfirmEmailChange(r.Context(), chi.URLParam(r, "code"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	m.updateSessionUser(r, user)
+
+	m.renderMessage(w, r, fmt.Sprintf("Your e-mail address has been changed to %s.", user.Address()), MessageStateSuccess, false)
+}
+
+func (m *Repository) RevertEmailChange(w http.ResponseWriter, r *http.Request) {
+	user, err := m.App.UserRegistration.RevertEmailChange(r.Context(), chi.URLParam(r, "code"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	m.updateSessionUser(r, user)
+
+	m.renderMessage(w, r, fmt.Sprintf("Your e-mail address has been changed back to %s. If you did not request the change, reset your password.", user.Address()), MessageStateWarning, false)
+}
+
+// updateSessionUser replaces the user in the session when the session belongs to the same account,
+// matched by creation time since the email address may have changed
+func (m *Repository) updateSessionUser(r *http.Request, user *ur.User) {
+	sessionUser, ok := m.sessionUser(r)
+	if !ok || !sessionUser.CreatedAt.Equal(user.CreatedAt) {
+		return
+	}
+
+	m.App.Session.Put(r.Context(), config.KeyUser, *user)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"github.com/caselongo/user-registration-go/internal/config"
 	"github.com/caselongo/user-registration-go/internal/forms"
@@ -27,13 +28,28 @@ func NewHandlers(a *config.AppConfig) {
 	}
 
 	gob.Register(ur.User{})
+	gob.Register(ur.OIDCAuthRequest{})
 }
 
 func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
-	render.RenderTemplate(w, r, "home.page.tmpl", &models.TemplateData{})
+	data := make(map[string]interface{})
+
+	user, _ := m.sessionUser(r)
+	if expiresAt, warn := m.App.UserRegistration.PasswordExpiry(user); warn {
+		data["password-expires"] = expiresAt.Format("2 January 2006")
+	}
+
+	render.RenderTemplate(w, r, "home.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
 }
 
 func (m *Repository) Register(w http.ResponseWriter, r *http.Request) {
+	if m.App.UserRegistration.InviteOnly() {
+		m.renderMessage(w, r, "Registration is by invitation. Ask someone with an account to invite you.", MessageStateWarning, true)
+		return
+	}
+
 	render.RenderTemplate(w, r, "register.page.tmpl", &models.TemplateData{
 		Form: forms.New(nil),
 	})
@@ -46,6 +62,11 @@ func (m *Repository) PostRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.FormValue("invite") != "" {
+		m.postAcceptInvitation(w, r)
+		return
+	}
+
 	form := forms.New(r.PostForm)
 	data := make(map[string]interface{})
 
@@ -66,41 +87,29 @@ func (m *Repository) PostRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ok, errEmail, errPassword, errConfirmPassword, err := m.App.UserRegistration.Register(r.FormValue("email"), r.FormValue("password"), r.FormValue("confirm-password"))
+	res, err := m.App.UserRegistration.Register(r.Context(), r.FormValue("email"), r.FormValue("password"), r.FormValue("confirm-password"))
 	if err != nil {
 		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
 		return
 	}
 
-	if ok {
+	if res.OK() {
 		if m.App.UserRegistration.HasMailSender() {
-			m.renderMessage(w, r, fmt.Sprintf("A confirmation e-mail will be sent to %s. Please check your inbox.", r.FormValue("email")), MessageStateSuccess, false)
+			m.renderMessage(w, r, fmt.Sprintf("A confirmation e-mail will be sent to %s. Please check your inbox.%s", res.User.Address(), awaitingApproval(res.User)), MessageStateSuccess, false)
 		} else {
-			m.renderMessage(w, r, "Your have successfully been registered.", MessageStateSuccess, true)
+			m.renderMessage(w, r, "Your have successfully been registered."+awaitingApproval(res.User), MessageStateSuccess, true)
 		}
 		return
 	}
 
-	if errEmail != "" {
-		form.Errors.Add("email", errEmail)
-	}
-
-	if errPassword != "" {
-		form.Errors.Add("password", errPassword)
-	}
-
-	if errConfirmPassword != "" {
-		form.Errors.Add("confirm-password", errConfirmPassword)
-	}
+	addFieldErrors(form, res)
 
 	renderPage(form)
 	return
 }
 
 func (m *Repository) Login(w http.ResponseWriter, r *http.Request) {
-	render.RenderTemplate(w, r, "login.page.tmpl", &models.TemplateData{
-		Form: forms.New(nil),
-	})
+	m.renderLogin(w, r, forms.New(nil), make(map[string]interface{}))
 }
 
 func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
@@ -119,35 +128,48 @@ func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 		data := make(map[string]interface{})
 		data["email"] = r.FormValue("email")
 
-		render.RenderTemplate(w, r, "login.page.tmpl", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
+		m.renderLogin(w, r, form, data)
 		return
 	}
 
-	user, errEmail, errPassword, err := m.App.UserRegistration.Login(r.FormValue("email"), r.FormValue("password"))
+	res, err := m.App.UserRegistration.Login(r.Context(), r.FormValue("email"), r.FormValue("password"))
 	if err != nil {
 		m.renderMessage(w, r, err.Error(), MessageStateDanger, true)
 		return
 	}
 
-	if user != nil {
-		m.App.Session.Put(r.Context(), config.KeyUser, user)
+	if res.TwoFactorRequired {
+		m.App.Session.Put(r.Context(), config.KeyTwoFactorEmail, r.FormValue("email"))
 
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, "/login/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	if res.PasswordExpired {
+		m.requirePasswordChange(w, r, r.FormValue("email"))
+		return
+	}
+
+	if res.OK() {
+		m.logIn(w, r, res)
+		return
 	}
 
 	data := make(map[string]interface{})
 	data["email"] = r.FormValue("email")
+	data["resend"] = errors.Is(res.Err(), ur.ErrNotConfirmed)
 
-	if errEmail != "" {
-		form.Errors.Add("email", errEmail)
-	}
+	addFieldErrors(form, res)
 
-	if errPassword != "" {
-		form.Errors.Add("password", errPassword)
-	}
+	m.renderLogin(w, r, form, data)
+}
+
+// renderLogin renders the login page with the ways to log in that are enabled
+func (m *Repository) renderLogin(w http.ResponseWriter, r *http.Request, form *forms.Form, data map[string]interface{}) {
+	mode := m.App.UserRegistration.MagicLinkMode()
+	data["magic-link"] = mode != ur.MagicLinkDisabled
+	data["password-login"] = mode != ur.MagicLinkInsteadOfPassword
+	data["oidc-clients"] = m.App.OIDCClients
 
 	render.RenderTemplate(w, r, "login.page.tmpl", &models.TemplateData{
 		Form: form,
@@ -155,6 +177,71 @@ func (m *Repository) PostLogin(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// logIn starts an authenticated session for the user of a successful login and redirects to the home page
+func (m *Repository) logIn(w http.ResponseWriter, r *http.Request, res *ur.Result) {
+	err := m.startSession(r, res.User)
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, true)
+		return
+	}
+
+	if res.DeletionCancelled {
+		m.App.Session.Put(r.Context(), config.KeyFlash, "The deletion of your account has been cancelled.")
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// startSession renews the session token and stores the user in it
+func (m *Repository) startSession(r *http.Request, user *ur.User) error {
+	err := m.App.Session.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	m.App.Session.Remove(r.Context(), config.KeyTwoFactorEmail)
+	m.App.Session.Remove(r.Context(), config.KeyExpiredEmail)
+	m.App.Session.Put(r.Context(), config.KeyUser, *user)
+
+	return nil
+}
+
+// logInVerified completes a login without a password, which may still require the second factor
+func (m *Repository) logInVerified(w http.ResponseWriter, r *http.Request, res *ur.Result) {
+	if res.TwoFactorRequired {
+		m.App.Session.Put(r.Context(), config.KeyTwoFactorEmail, res.User.Email)
+
+		http.Redirect(w, r, "/login/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	if !res.OK() {
+		m.renderMessage(w, r, res.Err().Error(), MessageStateDanger, true)
+		return
+	}
+
+	m.logIn(w, r, res)
+}
+
+// sessionUser returns the logged in user as stored in the session
+func (m *Repository) sessionUser(r *http.Request) (ur.User, bool) {
+	user, ok := m.App.Session.Get(r.Context(), config.KeyUser).(ur.User)
+	return user, ok
+}
+
+// hasPassword reports whether the logged in user has a password to confirm changes with. It is looked up,
+// since a password may have been set since the login.
+func (m *Repository) hasPassword(r *http.Request) bool {
+	sessionUser, _ := m.sessionUser(r)
+
+	user, err := m.App.UserRegistration.GetUser(r.Context(), sessionUser.Email)
+	if err != nil || user == nil {
+		return true
+	}
+
+	return user.HasPassword()
+}
+
 func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 	err := m.App.Session.Destroy(r.Context())
 	if err != nil {
@@ -167,7 +254,17 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) Confirm(w http.ResponseWriter, r *http.Request) {
 	code := chi.URLParam(r, "code")
 
-	err := m.App.UserRegistration.Confirm(code)
+	err := m.App.UserRegistration.Confirm(r.Context(), code)
+	if errors.Is(err, ur.ErrConfirmationCodeExpired) {
+		data := make(map[string]interface{})
+		data["message"] = err.Error()
+
+		render.RenderTemplate(w, r, "resend.page.tmpl", &models.TemplateData{
+			Form: forms.New(nil),
+			Data: data,
+		})
+		return
+	}
 	if err != nil {
 		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
 		return
@@ -176,10 +273,52 @@ func (m *Repository) Confirm(w http.ResponseWriter, r *http.Request) {
 	m.renderMessage(w, r, "Your have successfully been registered.", MessageStateSuccess, true)
 }
 
+func (m *Repository) ResendConfirmation(w http.ResponseWriter, r *http.Request) {
+	render.RenderTemplate(w, r, "resend.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+func (m *Repository) PostResendConfirmation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	form.Required("email")
+	form.IsEmail("email")
+
+	data := make(map[string]interface{})
+	data["email"] = r.FormValue("email")
+
+	if form.Valid() {
+		err = m.App.UserRegistration.ResendConfirmation(r.Context(), r.FormValue("email"))
+		if errors.Is(err, ur.ErrTooManyRequests) {
+			form.Errors.Add("email", err.Error())
+		} else if err != nil {
+			m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		render.RenderTemplate(w, r, "resend.page.tmpl", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
+
+	m.renderMessage(w, r, fmt.Sprintf("If %s is waiting for confirmation, a new confirmation e-mail will be sent to it. Please check your inbox.", r.FormValue("email")), MessageStateSuccess, true)
+}
+
 func (m *Repository) Reset(w http.ResponseWriter, r *http.Request) {
 	resetCode := chi.URLParam(r, "code")
 
-	_, err := m.App.UserRegistration.ValidateResetCode(resetCode)
+	_, err := m.App.UserRegistration.ValidateResetCode(r.Context(), resetCode)
 	if err != nil {
 		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
 		return
@@ -216,24 +355,18 @@ func (m *Repository) PostReset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ok, errPassword, errConfirmPassword, err := m.App.UserRegistration.Reset(r.FormValue("code"), r.FormValue("password"), r.FormValue("confirm-password"))
+	res, err := m.App.UserRegistration.Reset(r.Context(), r.FormValue("code"), r.FormValue("password"), r.FormValue("confirm-password"))
 	if err != nil {
 		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
 		return
 	}
 
-	if ok {
+	if res.OK() {
 		m.renderMessage(w, r, "Your new password has been saved.", MessageStateSuccess, true)
 		return
 	}
 
-	if errPassword != "" {
-		form.Errors.Add("password", errPassword)
-	}
-
-	if errConfirmPassword != "" {
-		form.Errors.Add("confirm-password", errConfirmPassword)
-	}
+	addFieldErrors(form, res)
 
 	render.RenderTemplate(w, r, "reset.page.tmpl", &models.TemplateData{
 		Form: form,
@@ -270,7 +403,7 @@ func (m *Repository) PostForgot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = m.App.UserRegistration.Forgot(r.FormValue("email"))
+	err = m.App.UserRegistration.Forgot(r.Context(), r.FormValue("email"))
 	if err != nil {
 		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
 		return
@@ -279,6 +412,28 @@ func (m *Repository) PostForgot(w http.ResponseWriter, r *http.Request) {
 	m.renderMessage(w, r, fmt.Sprintf("A password reset e-mail will be sent to %s. Please check your inbox.", r.FormValue("email")), MessageStateSuccess, false)
 }
 
+// Forbidden shows the page for users without the role or permission a page requires
+func (m *Repository) Forbidden(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusForbidden)
+	render.RenderTemplate(w, r, "forbidden.page.tmpl", &models.TemplateData{})
+}
+
+// awaitingApproval returns the addition to the registered message for a user that has to be approved first
+func awaitingApproval(user *ur.User) string {
+	if !user.ApprovalPending {
+		return ""
+	}
+
+	return " You can log in once your registration has been approved, you will receive an e-mail."
+}
+
+// addFieldErrors adds the field errors of a UserRegistration result to the form
+func addFieldErrors(form *forms.Form, res *ur.Result) {
+	for _, e := range res.Errors {
+		form.Errors.Add(e.Field, e.Message)
+	}
+}
+
 type MessageState string
 
 const (
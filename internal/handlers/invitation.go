@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/caselongo/user-registration-go/internal/forms"
+	"github.com/caselongo/user-registration-go/internal/models"
+	"github.com/caselongo/user-registration-go/internal/render"
+	ur "github.com/caselongo/user-registration-go/user-registration"
+	"github.com/go-chi/chi"
+	"net/http"
+)
+
+func (m *Repository) Invite(w http.ResponseWriter, r *http.Request) {
+	render.RenderTemplate(w, r, "invite.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+func (m *Repository) PostInvite(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	data := make(map[string]interface{})
+
+	renderPage := func(form *forms.Form) {
+		render.RenderTemplate(w, r, "invite.page.tmpl", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+	}
+
+	form.Required("email")
+	form.IsEmail("email")
+
+	data["email"] = r.FormValue("email")
+
+	if !form.Valid() {
+		renderPage(form)
+		return
+	}
+
+	sessionUser, _ := m.sessionUser(r)
+
+	res, err := m.App.UserRegistration.Invite(r.Context(), ur.Invitation{
+		Email:     r.FormValue("email"),
+		InvitedBy: sessionUser.Address(),
+	})
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	if res.OK() {
+		m.renderMessage(w, r, fmt.Sprintf("An invitation will be sent to %s.", r.FormValue("email")), MessageStateSuccess, false)
+		return
+	}
+
+	addFieldErrors(form, res)
+
+	renderPage(form)
+}
+
+// AcceptInvitation shows the register page for the invited address
+func (m *Repository) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+
+	invitation, err := m.App.UserRegistration.ValidateInvitation(r.Context(), code)
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["email"] = invitation.Email
+	data["invite"] = code
+
+	render.RenderTemplate(w, r, "register.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	})
+}
+
+// postAcceptInvitation registers the user of a register form that was opened from an invitation
+func (m *Repository) postAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	code := r.FormValue("invite")
+
+	form := forms.New(r.PostForm)
+	data := make(map[string]interface{})
+
+	renderPage := func(form *forms.Form) {
+		render.RenderTemplate(w, r, "register.page.tmpl", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+	}
+
+	invitation, err := m.App.UserRegistration.ValidateInvitation(r.Context(), code)
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	data["email"] = invitation.Email
+	data["invite"] = code
+
+	form.Required("password", "confirm-password")
+
+	if !form.Valid() {
+		renderPage(form)
+		return
+	}
+
+	res, err := m.App.UserRegistration.AcceptInvitation(r.Context(), code, r.FormValue("password"), r.FormValue("confirm-password"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	if res.OK() {
+		m.renderMessage(w, r, "Your have successfully been registered."+awaitingApproval(res.User), MessageStateSuccess, true)
+		return
+	}
+
+	addFieldErrors(form, res)
+
+	renderPage(form)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/caselongo/user-registration-go/internal/forms"
+	"github.com/caselongo/user-registration-go/internal/models"
+	"github.com/caselongo/user-registration-go/internal/render"
+	ur "github.com/caselongo/user-registration-go/user-registration"
+	"github.com/go-chi/chi"
+	"net/http"
+)
+
+func (m *Repository) PostRequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, true)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	data := make(map[string]interface{})
+
+	form.Required("link-email")
+	form.IsEmail("link-email")
+
+	data["link-email"] = r.FormValue("link-email")
+
+	if !form.Valid() {
+		m.renderLogin(w, r, form, data)
+		return
+	}
+
+	err = m.App.UserRegistration.RequestMagicLink(r.Context(), r.FormValue("link-email"))
+	if errors.Is(err, ur.ErrTooManyRequests) {
+		form.Errors.Add("link-email", err.Error())
+		m.renderLogin(w, r, form, data)
+		return
+	}
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, true)
+		return
+	}
+
+	m.renderMessage(w, r, fmt.Sprintf("A sign-in link will be sent to %s. Please check your inbox.", r.FormValue("link-email")), MessageStateSuccess, false)
+}
+
+// MagicLink asks to log in with the link, so links opened by e-mail scanners are not used up
+func (m *Repository) MagicLink(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["code"] = chi.URLParam(r, "code")
+
+	render.RenderTemplate(w, r, "magic-link.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+func (m *Repository) PostMagicLink(w http.ResponseWriter, r *http.Request) {
+	res, err := m.App.UserRegistration.LoginWithMagicLink(r.Context(), chi.URLParam(r, "code"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, true)
+		return
+	}
+
+	m.logInVerified(w, r, res)
+}
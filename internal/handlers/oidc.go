@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/caselongo/user-registration-go/internal/config"
+	ur "github.com/caselongo/user-registration-go/user-registration"
+	"github.com/go-chi/chi"
+	"net/http"
+)
+
+// OIDCLogin sends the user to the OpenID Connect provider to log in
+func (m *Repository) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	client := m.App.OIDCClient(chi.URLParam(r, "provider"))
+	if client == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	authURL, req, err := client.AuthCodeURL()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, true)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), config.KeyOIDCRequest, req)
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback logs in the user the OpenID Connect provider redirected back
+func (m *Repository) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	client := m.App.OIDCClient(chi.URLParam(r, "provider"))
+	if client == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	req, _ := m.App.Session.Pop(r.Context(), config.KeyOIDCRequest).(ur.OIDCAuthRequest)
+
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		m.renderMessage(w, r, fmt.Sprintf("Logging in with %s failed: %s", client.DisplayName(), q.Get("error")), MessageStateDanger, true)
+		return
+	}
+
+	claims, err := client.Exchange(r.Context(), req, q.Get("state"), q.Get("code"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, true)
+		return
+	}
+
+	res, err := m.App.UserRegistration.LoginWithOIDC(r.Context(), client.Name(), claims)
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, true)
+		return
+	}
+
+	m.logInVerified(w, r, res)
+}
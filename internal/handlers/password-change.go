@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"github.com/caselongo/user-registration-go/internal/config"
+	"github.com/caselongo/user-registration-go/internal/forms"
+	"github.com/caselongo/user-registration-go/internal/models"
+	"github.com/caselongo/user-registration-go/internal/render"
+	"net/http"
+)
+
+func (m *Repository) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	m.renderPasswordPage(w, r, forms.New(nil), false)
+}
+
+func (m *Repository) PostChangePassword(w http.ResponseWriter, r *http.Request) {
+	sessionUser, _ := m.sessionUser(r)
+
+	m.postChangePassword(w, r, sessionUser.Email, false)
+}
+
+// PasswordExpired shows the forced change of an expired password, before the session is granted
+func (m *Repository) PasswordExpired(w http.ResponseWriter, r *http.Request) {
+	if m.App.Session.GetString(r.Context(), config.KeyExpiredEmail) == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	m.renderPasswordPage(w, r, forms.New(nil), true)
+}
+
+func (m *Repository) PostPasswordExpired(w http.ResponseWriter, r *http.Request) {
+	email := m.App.Session.GetString(r.Context(), config.KeyExpiredEmail)
+	if email == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	m.postChangePassword(w, r, email, true)
+}
+
+// requirePasswordChange remembers the user of a login with an expired password and redirects to the change password page
+func (m *Repository) requirePasswordChange(w http.ResponseWriter, r *http.Request, email string) {
+	m.App.Session.Remove(r.Context(), config.KeyTwoFactorEmail)
+	m.App.Session.Put(r.Context(), config.KeyExpiredEmail, email)
+
+	http.Redirect(w, r, "/login/password-expired", http.StatusSeeOther)
+}
+
+func (m *Repository) postChangePassword(w http.ResponseWriter, r *http.Request, email string, expired bool) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, expired)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	form.Required("current-password", "password", "confirm-password")
+
+	if !form.Valid() {
+		m.renderPasswordPage(w, r, form, expired)
+		return
+	}
+
+	res, err := m.App.UserRegistration.ChangePassword(r.Context(), email, r.FormValue("current-password"), r.FormValue("password"), r.FormValue("confirm-password"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, expired)
+		return
+	}
+
+	if !res.OK() {
+		addFieldErrors(form, res)
+
+		m.renderPasswordPage(w, r, form, expired)
+		return
+	}
+
+	if expired {
+		m.logIn(w, r, res)
+		return
+	}
+
+	// the other sessions are invalidated by the new session version, this one is kept
+	err = m.App.Session.RenewToken(r.Context())
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	m.updateSessionUser(r, res.User)
+
+	m.renderMessage(w, r, "Your password has been changed. You have been logged out on all other devices.", MessageStateSuccess, false)
+}
+
+func (m *Repository) renderPasswordPage(w http.ResponseWriter, r *http.Request, form *forms.Form, expired bool) {
+	data := make(map[string]interface{})
+	data["expired"] = expired
+
+	render.RenderTemplate(w, r, "password.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"github.com/caselongo/user-registration-go/internal/config"
+	"github.com/go-chi/chi"
+	"net/http"
+)
+
+// reauthenticationPages are the pages a re-authentication link can return to
+var reauthenticationPages = map[string]bool{
+	"/account/delete":     true,
+	"/account/email":      true,
+	"/account/two-factor": true,
+}
+
+// PostRequestReauthentication sends a link to a user without a password to confirm a change to the account with
+func (m *Repository) PostRequestReauthentication(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	sessionUser, _ := m.sessionUser(r)
+
+	err = m.App.UserRegistration.RequestReauthentication(r.Context(), sessionUser.Email)
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), config.KeyReauthenticationNext, r.FormValue("next"))
+
+	m.renderMessage(w, r, "A link to confirm it is you will be sent to your e-mail address. Open it in this browser to continue.", MessageStateSuccess, false)
+}
+
+// Reauthenticate keeps the code of a re-authentication link in the session, to confirm the change with
+// once the user submits it. Opening the link does not use it up, so e-mail scanners cannot either.
+func (m *Repository) Reauthenticate(w http.ResponseWriter, r *http.Request) {
+	m.App.Session.Put(r.Context(), config.KeyReauthenticationCode, chi.URLParam(r, "code"))
+
+	next := m.App.Session.PopString(r.Context(), config.KeyReauthenticationNext)
+	if !reauthenticationPages[next] {
+		next = "/"
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// addConfirmationData tells a page that changes the account how the user confirms the change: with the
+// password, or with a re-authentication link that returns to the page at next. It returns whether the
+// user has a password.
+func (m *Repository) addConfirmationData(r *http.Request, data map[string]interface{}, next string) bool {
+	hasPassword := m.hasPassword(r)
+
+	data["has-password"] = hasPassword
+	data["reauthenticated"] = m.App.Session.Exists(r.Context(), config.KeyReauthenticationCode)
+	data["reauthentication-next"] = next
+
+	return hasPassword
+}
+
+// confirmation returns what the user confirms a change to the account with: the password entered, or
+// for users without one the code of the re-authentication link opened in this session
+func (m *Repository) confirmation(r *http.Request, hasPassword bool) string {
+	if hasPassword {
+		return r.FormValue("password")
+	}
+
+	return m.App.Session.GetString(r.Context(), config.KeyReauthenticationCode)
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"github.com/caselongo/user-registration-go/internal/config"
+	"github.com/caselongo/user-registration-go/internal/forms"
+	"github.com/caselongo/user-registration-go/internal/models"
+	"github.com/caselongo/user-registration-go/internal/render"
+	"html/template"
+	"net/http"
+)
+
+// TwoFactor shows the second step of a login for users with two-factor authentication
+func (m *Repository) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	if m.App.Session.GetString(r.Context(), config.KeyTwoFactorEmail) == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	render.RenderTemplate(w, r, "two-factor.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+func (m *Repository) PostTwoFactor(w http.ResponseWriter, r *http.Request) {
+	email := m.App.Session.GetString(r.Context(), config.KeyTwoFactorEmail)
+	if email == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, true)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	form.Required("code")
+
+	if !form.Valid() {
+		render.RenderTemplate(w, r, "two-factor.page.tmpl", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	res, err := m.App.UserRegistration.VerifyTwoFactor(r.Context(), email, r.FormValue("code"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, true)
+		return
+	}
+
+	if res.PasswordExpired {
+		m.requirePasswordChange(w, r, email)
+		return
+	}
+
+	if res.OK() {
+		m.logIn(w, r, res)
+		return
+	}
+
+	addFieldErrors(form, res)
+
+	render.RenderTemplate(w, r, "two-factor.page.tmpl", &models.TemplateData{
+		Form: form,
+	})
+}
+
+// TwoFactorSetup shows the two-factor authentication settings of the logged in user
+func (m *Repository) TwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	m.renderTwoFactorSetup(w, r, forms.New(nil), nil)
+}
+
+func (m *Repository) PostTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	sessionUser, _ := m.sessionUser(r)
+
+	_, err := m.App.UserRegistration.BeginTOTPEnrollment(r.Context(), sessionUser.Email)
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	http.Redirect(w, r, "/account/two-factor", http.StatusSeeOther)
+}
+
+func (m *Repository) PostTwoFactorEnable(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	form.Required("code")
+
+	if !form.Valid() {
+		m.renderTwoFactorSetup(w, r, form, nil)
+		return
+	}
+
+	sessionUser, _ := m.sessionUser(r)
+
+	res, err := m.App.UserRegistration.EnableTOTP(r.Context(), sessionUser.Email, r.FormValue("code"))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	addFieldErrors(form, res)
+
+	m.renderTwoFactorSetup(w, r, form, res.RecoveryCodes)
+}
+
+func (m *Repository) PostTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	hasPassword := m.hasPassword(r)
+	if hasPassword {
+		form.Required("password")
+	}
+
+	if !form.Valid() {
+		m.renderTwoFactorSetup(w, r, form, nil)
+		return
+	}
+
+	sessionUser, _ := m.sessionUser(r)
+
+	res, err := m.App.UserRegistration.DisableTOTP(r.Context(), sessionUser.Email, m.confirmation(r, hasPassword))
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	if res.OK() {
+		m.App.Session.Remove(r.Context(), config.KeyReauthenticationCode)
+		http.Redirect(w, r, "/account/two-factor", http.StatusSeeOther)
+		return
+	}
+
+	addFieldErrors(form, res)
+
+	m.renderTwoFactorSetup(w, r, form, nil)
+}
+
+func (m *Repository) renderTwoFactorSetup(w http.ResponseWriter, r *http.Request, form *forms.Form, recoveryCodes []string) {
+	sessionUser, _ := m.sessionUser(r)
+
+	user, err := m.App.UserRegistration.GetUser(r.Context(), sessionUser.Email)
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	if user == nil {
+		http.Redirect(w, r, "/logout", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["enabled"] = user.TOTPEnabledAt != nil
+	m.addConfirmationData(r, data, "/account/two-factor")
+	data["recovery-codes"] = recoveryCodes
+
+	enrollment, err := m.App.UserRegistration.TOTPEnrollment(r.Context(), user.Email)
+	if err != nil {
+		m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+		return
+	}
+
+	if enrollment != nil {
+		png, err := enrollment.QRCode(0)
+		if err != nil {
+			m.renderMessage(w, r, err.Error(), MessageStateDanger, false)
+			return
+		}
+
+		data["secret"] = enrollment.Secret
+		data["qr-code"] = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	}
+
+	render.RenderTemplate(w, r, "two-factor-setup.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
@@ -12,4 +12,5 @@ type TemplateData struct {
 	Form            *forms.Form
 	User            *ur.User
 	IsAuthenticated bool
+	Flash           string
 }
@@ -11,7 +11,9 @@ import (
 	"path/filepath"
 )
 
-var functions = template.FuncMap{}
+var functions = template.FuncMap{
+	"hasPermission": hasPermission,
+}
 
 var app *config.AppConfig
 
@@ -20,9 +22,15 @@ func NewRenderer(a *config.AppConfig) {
 	app = a
 }
 
+// hasPermission reports whether the user has the permission, for showing links to guarded pages
+func hasPermission(user *ur.User, permission string) bool {
+	return user != nil && app.UserRegistration.HasPermission(*user, permission)
+}
+
 // AddDefaultData adds data for all templates
 func AddDefaultData(td *models.TemplateData, r *http.Request) error {
 	td.CsrfToken = nosurf.Token(r)
+	td.Flash = app.Session.PopString(r.Context(), config.KeyFlash)
 
 	if td.Data == nil {
 		td.Data = make(map[string]interface{})
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/caselongo/user-registration-go/internal/models"
 	mail "github.com/xhit/go-simple-mail/v2"
+	"html"
 	"os"
 	"strings"
 	"time"
@@ -39,6 +41,16 @@ func (ms *MailSender) Close() {
 	close(ms.MailChan)
 }
 
+// send queues the mail, or gives up when the context is done before the listener picks it up
+func (ms *MailSender) send(ctx context.Context, data models.MailData) error {
+	select {
+	case ms.MailChan <- data:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func sendMail(data models.MailData) {
 	server := mail.NewSMTPClient()
 	server.Host = smtpHost
@@ -81,42 +93,182 @@ func sendMail(data models.MailData) {
 	}
 }
 
-func (ms *MailSender) Confirm(email, code string) error {
-	d, err := os.ReadFile("./email-templates/confirm.html")
+func (ms *MailSender) Confirm(ctx context.Context, email, code string) error {
+	content, err := mailContent("confirm.html", "[%url%]", fmt.Sprintf("%s/confirm/%s", app.Host(), code))
 	if err != nil {
 		return err
 	}
 
-	url := fmt.Sprintf("%s/confirm/%s", app.Host(), code)
+	return ms.send(ctx, models.MailData{
+		To:      email,
+		From:    noReplyEmail,
+		Subject: "Confirm your e-mail address",
+		Content: content,
+	})
+}
 
-	mailTemplate := string(d)
-	content := strings.ReplaceAll(mailTemplate, "[%url%]", url)
+func (ms *MailSender) Reset(ctx context.Context, email, code string) error {
+	content, err := mailContent("reset.html", "[%url%]", fmt.Sprintf("%s/reset/%s", app.Host(), code))
+	if err != nil {
+		return err
+	}
 
-	ms.MailChan <- models.MailData{
+	return ms.send(ctx, models.MailData{
 		To:      email,
 		From:    noReplyEmail,
-		Subject: "Confirm your e-mail address",
+		Subject: "Reset your password",
 		Content: content,
+	})
+}
+
+func (ms *MailSender) ConfirmEmailChange(ctx context.Context, newEmail, code string) error {
+	content, err := mailContent("email-change.html", "[%url%]", fmt.Sprintf("%s/email/confirm/%s", app.Host(), code))
+	if err != nil {
+		return err
 	}
-	return nil
+
+	return ms.send(ctx, models.MailData{
+		To:      newEmail,
+		From:    noReplyEmail,
+		Subject: "Confirm your new e-mail address",
+		Content: content,
+	})
 }
 
-func (ms *MailSender) Reset(email, code string) error {
-	d, err := os.ReadFile("./email-templates/reset.html")
+func (ms *MailSender) EmailChanged(ctx context.Context, oldEmail, newEmail, revertCode string) error {
+	content, err := mailContent("email-changed.html",
+		"[%url%]", fmt.Sprintf("%s/email/revert/%s", app.Host(), revertCode),
+		"[%email%]", html.EscapeString(newEmail))
 	if err != nil {
 		return err
 	}
 
-	url := fmt.Sprintf("%s/reset/%s", app.Host(), code)
+	return ms.send(ctx, models.MailData{
+		To:      oldEmail,
+		From:    noReplyEmail,
+		Subject: "Your e-mail address was changed",
+		Content: content,
+	})
+}
 
-	mailTemplate := string(d)
-	content := strings.ReplaceAll(mailTemplate, "[%url%]", url)
+func (ms *MailSender) DeletionScheduled(ctx context.Context, email string, deleteAt time.Time) error {
+	content, err := mailContent("account-deletion.html",
+		"[%url%]", fmt.Sprintf("%s/login", app.Host()),
+		"[%date%]", deleteAt.Format("2 January 2006 15:04"))
+	if err != nil {
+		return err
+	}
 
-	ms.MailChan <- models.MailData{
+	return ms.send(ctx, models.MailData{
 		To:      email,
 		From:    noReplyEmail,
-		Subject: "Reset your password",
+		Subject: "Your account will be deleted",
+		Content: content,
+	})
+}
+
+func (ms *MailSender) PasswordChanged(ctx context.Context, email string) error {
+	content, err := mailContent("password-changed.html",
+		"[%url%]", fmt.Sprintf("%s/forgot", app.Host()))
+	if err != nil {
+		return err
+	}
+
+	return ms.send(ctx, models.MailData{
+		To:      email,
+		From:    noReplyEmail,
+		Subject: "Your password was changed",
 		Content: content,
+	})
+}
+
+func (ms *MailSender) Invite(ctx context.Context, email, invitedBy, code string) error {
+	from := "We"
+	if invitedBy != "" {
+		from = html.EscapeString(invitedBy)
 	}
-	return nil
+
+	content, err := mailContent("invite.html",
+		"[%url%]", fmt.Sprintf("%s/invite/%s", app.Host(), code),
+		"[%from%]", from)
+	if err != nil {
+		return err
+	}
+
+	return ms.send(ctx, models.MailData{
+		To:      email,
+		From:    noReplyEmail,
+		Subject: "You are invited to User Registration",
+		Content: content,
+	})
+}
+
+func (ms *MailSender) RegistrationApproved(ctx context.Context, email string) error {
+	content, err := mailContent("registration-approved.html", "[%url%]", fmt.Sprintf("%s/login", app.Host()))
+	if err != nil {
+		return err
+	}
+
+	return ms.send(ctx, models.MailData{
+		To:      email,
+		From:    noReplyEmail,
+		Subject: "Your registration has been approved",
+		Content: content,
+	})
+}
+
+func (ms *MailSender) RegistrationRejected(ctx context.Context, email, reason string) error {
+	if reason != "" {
+		reason = fmt.Sprintf("Reason: %s", html.EscapeString(reason))
+	}
+
+	content, err := mailContent("registration-rejected.html", "[%reason%]", reason)
+	if err != nil {
+		return err
+	}
+
+	return ms.send(ctx, models.MailData{
+		To:      email,
+		From:    noReplyEmail,
+		Subject: "Your registration has been rejected",
+		Content: content,
+	})
+}
+
+func (ms *MailSender) MagicLink(ctx context.Context, email, code string) error {
+	content, err := mailContent("magic-link.html", "[%url%]", fmt.Sprintf("%s/login/link/%s", app.Host(), code))
+	if err != nil {
+		return err
+	}
+
+	return ms.send(ctx, models.MailData{
+		To:      email,
+		From:    noReplyEmail,
+		Subject: "Your sign-in link",
+		Content: content,
+	})
+}
+
+func (ms *MailSender) Reauthenticate(ctx context.Context, email, code string) error {
+	content, err := mailContent("reauthenticate.html", "[%url%]", fmt.Sprintf("%s/account/reauthenticate/%s", app.Host(), code))
+	if err != nil {
+		return err
+	}
+
+	return ms.send(ctx, models.MailData{
+		To:      email,
+		From:    noReplyEmail,
+		Subject: "Confirm the change to your account",
+		Content: content,
+	})
+}
+
+// mailContent reads an e-mail template and replaces its placeholders, given as old, new pairs
+func mailContent(template string, oldnew ...string) (string, error) {
+	d, err := os.ReadFile(fmt.Sprintf("./email-templates/%s", template))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.NewReplacer(oldnew...).Replace(string(d)), nil
 }
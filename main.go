@@ -1,6 +1,14 @@
 package main
 
 import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"github.com/alexedwards/scs/v2"
 	"github.com/caselongo/user-registration-go/internal/config"
@@ -9,6 +17,7 @@ import (
 	ur "github.com/caselongo/user-registration-go/user-registration"
 	"log"
 	"net/http"
+	"os"
 	"time"
 )
 
@@ -41,17 +50,38 @@ func main() {
 
 	log.Println("IsTest =", app.IsTest())
 
+	accessTokenKeys, err := loadAccessTokenKeys()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	uint1 := uint(1)
+	uint2 := uint(2)
 	userSource := NewUserSource()
 	mailSender := NewMailSender()
 	userRegistration, err := ur.NewUserRegistration(&ur.NewUserRegistrationConfig{
 		UserSource: userSource,
 		MailSender: mailSender,
 		PasswordRequirements: &ur.PasswordRequirements{
-			MinUppers:   &uint1,
-			MinNumbers:  &uint1,
-			MinSpecials: &uint1,
+			MinUppers:        &uint1,
+			MinNumbers:       &uint1,
+			MinSpecials:      &uint1,
+			MinStrengthScore: &uint2,
+		},
+		LockoutPolicy: &ur.LockoutPolicy{},
+		RegistrationPolicy: &ur.RegistrationPolicy{
+			BlockDisposable: true,
 		},
+		InviteOnly:       app.InviteOnly(),
+		ApprovalRequired: app.ApprovalRequired(),
+		RolePermissions: map[string][]string{
+			"staff": {config.PermissionApproveRegistrations},
+		},
+		AdminEmails:       app.AdminEmails(),
+		FirstUserIsAdmin:  app.FirstUserIsAdmin(),
+		MagicLink:         app.MagicLink(),
+		AccessTokenKeys:   accessTokenKeys,
+		AccessTokenIssuer: app.Host(),
 	})
 
 	if err != nil {
@@ -64,6 +94,18 @@ func main() {
 
 	app.UserRegistration = userRegistration
 
+	for _, provider := range app.OIDCProviders() {
+		client, err := ur.NewOIDCClient(context.Background(), provider, nil)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		app.OIDCClients = append(app.OIDCClients, client)
+	}
+
+	go userRegistration.RunDeletionPurger(context.Background(), time.Hour)
+
 	srv := &http.Server{
 		Addr:    app.Port(),
 		Handler: routes(&app),
@@ -76,3 +118,51 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// loadAccessTokenKeys returns the key that signs access tokens. Without ACCESS_TOKEN_KEY_FILE or
+// ACCESS_TOKEN_SECRET a temporary key is generated, so tokens are no longer valid after a restart.
+func loadAccessTokenKeys() ([]ur.SigningKey, error) {
+	if app.AccessTokenKeyFile() != "" {
+		b, err := os.ReadFile(app.AccessTokenKeyFile())
+		if err != nil {
+			return nil, err
+		}
+
+		block, _ := pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("%s does not contain a PEM encoded key", app.AccessTokenKeyFile())
+		}
+
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", app.AccessTokenKeyFile(), err)
+		}
+
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported key type %T", app.AccessTokenKeyFile(), key)
+		}
+
+		// the kid is derived from the public key, so it changes when the key is replaced
+		der, err := x509.MarshalPKIXPublicKey(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(der)
+
+		return []ur.SigningKey{{ID: hex.EncodeToString(sum[:8]), Key: key}}, nil
+	}
+
+	if app.AccessTokenSecret() != "" {
+		return []ur.SigningKey{{ID: "hs256", Key: []byte(app.AccessTokenSecret())}}, nil
+	}
+
+	log.Println("no ACCESS_TOKEN_KEY_FILE or ACCESS_TOKEN_SECRET set, access tokens are signed with a temporary key")
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return []ur.SigningKey{{ID: "temporary", Key: key}}, nil
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"github.com/caselongo/user-registration-go/internal/config"
+	"github.com/caselongo/user-registration-go/internal/handlers"
 	ur "github.com/caselongo/user-registration-go/user-registration"
 	"github.com/justinas/nosurf"
+	"log"
+	"mime"
 	"net/http"
+	"strings"
 )
 
 // NoSurf is the csrf protection middleware
@@ -18,9 +22,33 @@ func NoSurf(next http.Handler) http.Handler {
 		SameSite: http.SameSiteLaxMode,
 	})
 
+	// the api is protected by requiring a JSON body instead, see JSONOnly
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/api/")
+	})
+
 	return csrfHandler
 }
 
+// JSONOnly refuses requests that change something unless they have a JSON body.
+// Browsers only send such requests cross-site after a CORS preflight, which is never allowed,
+// so this protects the api against csrf without a token that non-browser clients would have to fetch first.
+func JSONOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				handlers.Repo.APIUnsupportedMediaType(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // SessionLoad loads and saves session data for current request
 func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
@@ -34,9 +62,124 @@ func NoAuth(next http.Handler) http.Handler {
 	return checkAuth(true, "/", next)
 }
 
+// RequireRole only lets users with at least one of the roles through, use it after Auth
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return requireUser(func(user *ur.User) bool {
+		for _, role := range roles {
+			if user.HasRole(role) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// RequirePermission only lets users with all the permissions through, use it after Auth
+func RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return requireUser(func(user *ur.User) bool {
+		for _, permission := range permissions {
+			if !app.UserRegistration.HasPermission(*user, permission) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// requireUser shows the forbidden page to users for which allowed returns false
+func requireUser(allowed func(user *ur.User) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := session.Get(r.Context(), config.KeyUser).(ur.User)
+
+			// the roles in the session may be outdated
+			current, err := app.UserRegistration.GetUser(r.Context(), user.Email)
+			if err != nil {
+				serverError(w, err)
+				return
+			}
+
+			if current == nil || !allowed(current) {
+				handlers.Repo.Forbidden(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// serverError logs the error and answers with a generic 500, the error may hold internal details
+func serverError(w http.ResponseWriter, err error) {
+	log.Println(err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// BearerAuth puts the user of the access token in the Authorization header in the request context.
+// Requests with an invalid token are refused, requests without one are passed on, so the session still works.
+func BearerAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, token, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			handlers.Repo.APIInvalidAccessToken(w, r)
+			return
+		}
+
+		claims, err := app.UserRegistration.VerifyAccessToken(strings.TrimSpace(token))
+		if err != nil {
+			handlers.Repo.APIInvalidAccessToken(w, r)
+			return
+		}
+
+		// access tokens of deleted users or users logged out everywhere are refused before they expire
+		user, err := app.UserRegistration.ValidateSession(r.Context(), ur.User{
+			Email:          claims.Subject,
+			SessionVersion: claims.SessionVersion,
+		})
+		if err != nil {
+			handlers.Repo.APIInternalError(w, r, err)
+			return
+		}
+
+		if user == nil {
+			handlers.Repo.APIInvalidAccessToken(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ur.ContextWithUser(r.Context(), user)))
+	})
+}
+
 func checkAuth(ok bool, url string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, okAuth := session.Get(r.Context(), config.KeyUser).(ur.User)
+		user, okAuth := session.Get(r.Context(), config.KeyUser).(ur.User)
+		if okAuth {
+			// the session is ended when the account was deleted or logged out everywhere
+			current, err := app.UserRegistration.ValidateSession(r.Context(), user)
+			if err != nil {
+				serverError(w, err)
+				return
+			}
+
+			if current == nil {
+				err = session.Destroy(r.Context())
+				if err != nil {
+					serverError(w, err)
+					return
+				}
+
+				okAuth = false
+			}
+		}
+
 		if ok == okAuth {
 			http.Redirect(w, r, url, http.StatusSeeOther)
 			return
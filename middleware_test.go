@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/alexedwards/scs/v2"
+	"github.com/caselongo/user-registration-go/internal/config"
+	"github.com/caselongo/user-registration-go/internal/handlers"
+	"github.com/caselongo/user-registration-go/internal/render"
+	ur "github.com/caselongo/user-registration-go/user-registration"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setUpTestApp sets up the app with a UserSource as main does, without a mail sender.
+func setUpTestApp(t *testing.T, userSource ur.UserSource) {
+	t.Helper()
+
+	session = scs.New()
+	app.Session = session
+
+	handlers.NewHandlers(&app)
+	render.NewRenderer(&app)
+
+	userRegistration, err := ur.NewUserRegistration(&ur.NewUserRegistrationConfig{
+		UserSource:           userSource,
+		PasswordRequirements: &ur.PasswordRequirements{},
+		PasswordHasher:       &ur.ScryptHasher{LogN: 4},
+		AccessTokenKeys:      []ur.SigningKey{{ID: "test", Key: []byte("a test secret of at least 32 bytes")}},
+		RolePermissions: map[string][]string{
+			"staff": {config.PermissionApproveRegistrations},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.UserRegistration = userRegistration
+}
+
+// serveAs serves the request with the user logged in, or without a session user when it is nil.
+func serveAs(t *testing.T, h http.Handler, user *ur.User) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+
+	ctx, err := session.Load(r.Context(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user != nil {
+		session.Put(ctx, config.KeyUser, *user)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r.WithContext(ctx))
+
+	return w
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestRequireRole(t *testing.T) {
+	users := NewUserSource()
+	setUpTestApp(t, users)
+
+	now := time.Now()
+	for _, user := range []ur.User{
+		{Email: "admin@example.com", Roles: []string{ur.RoleAdmin}},
+		{Email: "staff@example.com", Roles: []string{"staff"}},
+		{Email: "bob@example.com"},
+	} {
+		user.CreatedAt = now
+		if err := users.Insert(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := RequireRole("staff", ur.RoleAdmin)(okHandler)
+
+	tests := []struct {
+		name string
+		user *ur.User
+		want int
+	}{
+		{"admin", &ur.User{Email: "admin@example.com"}, http.StatusOK},
+		{"one of the roles", &ur.User{Email: "staff@example.com"}, http.StatusOK},
+		{"no role", &ur.User{Email: "bob@example.com"}, http.StatusForbidden},
+		// the roles are looked up, those in the session may be outdated
+		{"role only in the session", &ur.User{Email: "bob@example.com", Roles: []string{"staff"}}, http.StatusForbidden},
+		{"unknown user", &ur.User{Email: "eve@example.com", Roles: []string{ur.RoleAdmin}}, http.StatusForbidden},
+		{"no session user", nil, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveAs(t, h, tt.user); w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	users := NewUserSource()
+	setUpTestApp(t, users)
+
+	for _, user := range []ur.User{
+		{Email: "staff@example.com", Roles: []string{"staff"}},
+		{Email: "bob@example.com"},
+	} {
+		if err := users.Insert(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := RequirePermission(config.PermissionApproveRegistrations)(okHandler)
+
+	if w := serveAs(t, h, &ur.User{Email: "staff@example.com"}); w.Code != http.StatusOK {
+		t.Errorf("permission of a role: status %d", w.Code)
+	}
+
+	if w := serveAs(t, h, &ur.User{Email: "bob@example.com"}); w.Code != http.StatusForbidden {
+		t.Errorf("without the permission: status %d", w.Code)
+	}
+}
+
+// failingUserSource fails to look up users, with an error that must not be shown.
+type failingUserSource struct {
+	*UserSource
+}
+
+func (s failingUserSource) Select(_ context.Context, _ string) (*ur.User, error) {
+	return nil, errors.New("connecting to db.internal:5432 failed")
+}
+
+func TestRequireRoleUserSourceFails(t *testing.T) {
+	setUpTestApp(t, failingUserSource{NewUserSource()})
+
+	w := serveAs(t, RequireRole(ur.RoleAdmin)(okHandler), &ur.User{Email: "admin@example.com"})
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	if strings.Contains(w.Body.String(), "db.internal") {
+		t.Errorf("internal error shown: %q", w.Body.String())
+	}
+}
+
+func TestBearerAuthUserSourceFails(t *testing.T) {
+	setUpTestApp(t, failingUserSource{NewUserSource()})
+
+	tokens, err := app.UserRegistration.IssueTokens(context.Background(), &ur.User{Email: "bob@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/user", nil)
+	r.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+	w := httptest.NewRecorder()
+	BearerAuth(okHandler).ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("Content-Type %q, want JSON", ct)
+	}
+
+	if strings.Contains(w.Body.String(), "db.internal") {
+		t.Errorf("internal error shown: %q", w.Body.String())
+	}
+}
@@ -18,14 +18,67 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.With(Auth).Get("/", handlers.Repo.Home)
 	mux.With(NoAuth).Get("/login", handlers.Repo.Login)
 	mux.Post("/login", handlers.Repo.PostLogin)
+	mux.With(NoAuth).Get("/login/two-factor", handlers.Repo.TwoFactor)
+	mux.With(NoAuth).Post("/login/two-factor", handlers.Repo.PostTwoFactor)
+	mux.With(NoAuth).Get("/login/password-expired", handlers.Repo.PasswordExpired)
+	mux.With(NoAuth).Post("/login/password-expired", handlers.Repo.PostPasswordExpired)
+	mux.Post("/login/link", handlers.Repo.PostRequestMagicLink)
+	mux.With(NoAuth).Get("/login/link/{code}", handlers.Repo.MagicLink)
+	mux.Post("/login/link/{code}", handlers.Repo.PostMagicLink)
+	mux.With(NoAuth).Get("/login/oidc/{provider}", handlers.Repo.OIDCLogin)
+	mux.With(NoAuth).Get("/login/oidc/{provider}/callback", handlers.Repo.OIDCCallback)
 	mux.With(NoAuth).Get("/register", handlers.Repo.Register)
 	mux.Post("/register", handlers.Repo.PostRegister)
+	mux.With(NoAuth).Get("/invite/{code}", handlers.Repo.AcceptInvitation)
+	mux.With(NoAuth).Get("/confirm/resend", handlers.Repo.ResendConfirmation)
+	mux.Post("/confirm/resend", handlers.Repo.PostResendConfirmation)
 	mux.With(NoAuth).Get("/confirm/{code}", handlers.Repo.Confirm)
 	mux.With(NoAuth).Get("/forgot", handlers.Repo.Forgot)
 	mux.Post("/forgot", handlers.Repo.PostForgot)
 	mux.With(NoAuth).Get("/reset/{code}", handlers.Repo.Reset)
 	mux.Post("/reset", handlers.Repo.PostReset)
 	mux.With(Auth).Get("/logout", handlers.Repo.Logout)
+	mux.With(Auth).Post("/account/reauthenticate", handlers.Repo.PostRequestReauthentication)
+	mux.With(Auth).Get("/account/reauthenticate/{code}", handlers.Repo.Reauthenticate)
+	mux.With(Auth).Get("/account/email", handlers.Repo.ChangeEmail)
+	mux.With(Auth).Post("/account/email", handlers.Repo.PostChangeEmail)
+	mux.Get("/email/confirm/{code}", handlers.Repo.ConfirmEmailChange)
+	mux.Get("/email/revert/{code}", handlers.Repo.RevertEmailChange)
+	mux.With(Auth).Get("/account/password", handlers.Repo.ChangePassword)
+	mux.With(Auth).Post("/account/password", handlers.Repo.PostChangePassword)
+	mux.With(Auth).Get("/account/two-factor", handlers.Repo.TwoFactorSetup)
+	mux.With(Auth).Post("/account/two-factor/enroll", handlers.Repo.PostTwoFactorEnroll)
+	mux.With(Auth).Post("/account/two-factor/enable", handlers.Repo.PostTwoFactorEnable)
+	mux.With(Auth).Post("/account/two-factor/disable", handlers.Repo.PostTwoFactorDisable)
+	mux.With(Auth).Get("/account/invite", handlers.Repo.Invite)
+	mux.With(Auth).Post("/account/invite", handlers.Repo.PostInvite)
+	mux.With(Auth).Get("/account/delete", handlers.Repo.DeleteAccount)
+	mux.With(Auth).Post("/account/delete", handlers.Repo.PostDeleteAccount)
+	approve := RequirePermission(config.PermissionApproveRegistrations)
+	mux.With(Auth, approve).Get("/admin/approvals", handlers.Repo.Approvals)
+	mux.With(Auth, approve).Post("/admin/approvals/approve", handlers.Repo.PostApprove)
+	mux.With(Auth, approve).Post("/admin/approvals/reject", handlers.Repo.PostReject)
+
+	mux.Route("/api/v1", func(api chi.Router) {
+		api.Use(JSONOnly)
+		api.Use(BearerAuth)
+		api.NotFound(handlers.Repo.APINotFound)
+		api.MethodNotAllowed(handlers.Repo.APIMethodNotAllowed)
+
+		api.Get("/openapi.json", handlers.Repo.APIOpenAPI)
+		api.Post("/register", handlers.Repo.APIRegister)
+		api.Post("/login", handlers.Repo.APILogin)
+		api.Post("/login/two-factor", handlers.Repo.APILoginTwoFactor)
+		api.Post("/logout", handlers.Repo.APILogout)
+		api.Post("/confirm", handlers.Repo.APIConfirm)
+		api.Post("/forgot", handlers.Repo.APIForgot)
+		api.Post("/reset", handlers.Repo.APIReset)
+		api.Get("/me", handlers.Repo.APIMe)
+		api.Post("/token", handlers.Repo.APIToken)
+		api.Post("/token/refresh", handlers.Repo.APIRefreshToken)
+		api.Post("/token/revoke", handlers.Repo.APIRevokeToken)
+	})
+	mux.Get("/.well-known/jwks.json", handlers.Repo.JWKS)
 
 	return mux
 }
@@ -0,0 +1,369 @@
+package user_registration
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultAccessTokenExpiry  = 15 * time.Minute
+	defaultRefreshTokenExpiry = 30 * 24 * time.Hour
+	minSecretLength           = 32
+	minRSAKeyBits             = 2048
+	accessTokenClockSkew      = time.Minute
+)
+
+var (
+	ErrInvalidAccessToken  = errors.New("invalid or expired access token")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token used before, all tokens of the login have been revoked")
+	errAccessTokensOff     = errors.New("no access token signing keys configured")
+)
+
+// SigningKey signs access tokens: a []byte secret of at least 32 bytes for HS256, an *rsa.PrivateKey
+// of at least 2048 bits for RS256 or an ed25519.PrivateKey for EdDSA. ID is the kid in the token header.
+type SigningKey struct {
+	ID  string
+	Key interface{}
+}
+
+// algorithm returns the JWS algorithm of the key, and the key its tokens are verified with.
+func (k SigningKey) algorithm() (string, crypto.PublicKey, error) {
+	switch key := k.Key.(type) {
+	case []byte:
+		if len(key) < minSecretLength {
+			return "", nil, fmt.Errorf("HS256 secret must be at least %d bytes", minSecretLength)
+		}
+
+		return "HS256", key, nil
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return "", nil, fmt.Errorf("RSA key must be at least %d bits", minRSAKeyBits)
+		}
+
+		return "RS256", &key.PublicKey, nil
+	case ed25519.PrivateKey:
+		if len(key) != ed25519.PrivateKeySize {
+			return "", nil, errors.New("invalid Ed25519 key")
+		}
+
+		return "EdDSA", key.Public(), nil
+	}
+
+	return "", nil, fmt.Errorf("unsupported signing key type %T", k.Key)
+}
+
+// signingKey is a configured SigningKey with its algorithm.
+type signingKey struct {
+	id        string
+	alg       string
+	key       interface{}
+	publicKey crypto.PublicKey
+}
+
+func newSigningKeys(keys []SigningKey) ([]signingKey, error) {
+	result := make([]signingKey, 0, len(keys))
+	ids := make(map[string]bool, len(keys))
+
+	for _, k := range keys {
+		if k.ID == "" || ids[k.ID] {
+			return nil, fmt.Errorf("signing key ID %q is empty or not unique", k.ID)
+		}
+		ids[k.ID] = true
+
+		alg, publicKey, err := k.algorithm()
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", k.ID, err)
+		}
+
+		result = append(result, signingKey{
+			id:        k.ID,
+			alg:       alg,
+			key:       k.Key,
+			publicKey: publicKey,
+		})
+	}
+
+	return result, nil
+}
+
+// AccessTokenClaims are the claims of an access token. Subject is the normalized address, which is the
+// key of the UserSource, and SessionVersion changes when the user logs out everywhere.
+type AccessTokenClaims struct {
+	Issuer         string   `json:"iss,omitempty"`
+	Subject        string   `json:"sub"`
+	Audience       string   `json:"aud,omitempty"`
+	Expiry         int64    `json:"exp"`
+	IssuedAt       int64    `json:"iat"`
+	ID             string   `json:"jti"`
+	Email          string   `json:"email"`
+	Roles          []string `json:"roles,omitempty"`
+	SessionVersion uint     `json:"sv"`
+}
+
+// TokenPair is the response to a login or refresh, in the format of an OAuth 2.0 token response.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshTokenData is stored with a refresh token. All refresh tokens rotated from the same login share
+// the family, which is revoked as a whole when one of them is used twice.
+type refreshTokenData struct {
+	Family         string `json:"family"`
+	SessionVersion uint   `json:"session_version"`
+}
+
+// AccessTokensEnabled returns whether signing keys are configured, so access tokens can be issued.
+func (u *UserRegistration) AccessTokensEnabled() bool {
+	return len(u.signingKeys) > 0
+}
+
+// JWKS returns the public keys access tokens are verified with, to publish at a JWKS endpoint.
+// HS256 secrets are not included, services verifying those tokens need the secret itself.
+func (u *UserRegistration) JWKS() (JSONWebKeySet, error) {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	for _, k := range u.signingKeys {
+		if k.alg == "HS256" {
+			continue
+		}
+
+		jwk, err := NewJSONWebKey(k.id, k.publicKey)
+		if err != nil {
+			return JSONWebKeySet{}, err
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+// IssueTokens returns an access token and a refresh token for a user that has logged in, which start
+// a new family of refresh tokens.
+func (u *UserRegistration) IssueTokens(ctx context.Context, user *User) (*TokenPair, error) {
+	if !u.AccessTokensEnabled() {
+		return nil, errAccessTokensOff
+	}
+
+	_, family, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return u.issueTokens(ctx, user, family)
+}
+
+// RefreshTokens exchanges a refresh token for a new access token and refresh token. Each refresh token
+// can be used once. When a used one is presented again it may have been stolen, so all tokens of the
+// login are revoked and ErrRefreshTokenReused is returned.
+func (u *UserRegistration) RefreshTokens(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	if !u.AccessTokensEnabled() {
+		return nil, errAccessTokensOff
+	}
+
+	t, err := u.useToken(ctx, TokenPurposeRefresh, refreshToken)
+	if errors.Is(err, errTokenUsed) {
+		err = u.revokeRefreshTokens(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrRefreshTokenReused
+	}
+	if errors.Is(err, errTokenExpired) || (err == nil && t == nil) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data refreshTokenData
+
+	err = json.Unmarshal([]byte(t.Data), &data)
+	if err != nil {
+		return nil, err
+	}
+
+	family, err := u.tokens.Get(ctx, data.Family)
+	if err != nil {
+		return nil, err
+	}
+
+	if family == nil || family.Purpose != TokenPurposeRefreshFamily || time.Now().After(family.Expiry) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// refreshing ends when the user is deleted or logged out everywhere
+	user, err := u.ValidateSession(ctx, User{Email: t.Email, SessionVersion: data.SessionVersion})
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		err = u.tokens.Delete(ctx, data.Family)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return u.issueTokens(ctx, user, data.Family)
+}
+
+// RevokeRefreshToken revokes the refresh token and all others of the same login, e.g. on logout.
+// Access tokens stay valid until they expire. Unknown tokens are ignored.
+func (u *UserRegistration) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	t, _, err := u.lookupToken(ctx, TokenPurposeRefresh, refreshToken)
+	if err != nil || t == nil {
+		return err
+	}
+
+	return u.revokeRefreshTokens(ctx, t)
+}
+
+func (u *UserRegistration) revokeRefreshTokens(ctx context.Context, t *Token) error {
+	var data refreshTokenData
+
+	err := json.Unmarshal([]byte(t.Data), &data)
+	if err != nil {
+		return err
+	}
+
+	return u.tokens.Delete(ctx, data.Family)
+}
+
+func (u *UserRegistration) issueTokens(ctx context.Context, user *User, family string) (*TokenPair, error) {
+	accessToken, err := u.signAccessToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := time.Now().Add(u.refreshTokenExpiry)
+
+	// the family lives as long as its most recent refresh token
+	err = u.tokens.Set(ctx, family, Token{
+		Purpose: TokenPurposeRefreshFamily,
+		Email:   user.Email,
+		Expiry:  expiry,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(refreshTokenData{
+		Family:         family,
+		SessionVersion: user.SessionVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, _, err := u.issueToken(ctx, TokenPurposeRefresh, user.Email, string(data), u.refreshTokenExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(u.accessTokenExpiry / time.Second),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// signAccessToken returns an access token for the user, signed with the first signing key.
+func (u *UserRegistration) signAccessToken(user *User) (string, error) {
+	_, id, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	payload, err := json.Marshal(AccessTokenClaims{
+		Issuer:         u.accessTokenIssuer,
+		Subject:        user.Email,
+		Audience:       u.accessTokenAudience,
+		Expiry:         now.Add(u.accessTokenExpiry).Unix(),
+		IssuedAt:       now.Unix(),
+		ID:             id,
+		Email:          user.Address(),
+		Roles:          user.Roles,
+		SessionVersion: user.SessionVersion,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	k := u.signingKeys[0]
+
+	return signJWS(jwsHeader{Alg: k.alg, Kid: k.id, Typ: "at+jwt"}, payload, k.key)
+}
+
+// VerifyAccessToken checks the signature, issuer, audience and expiry of an access token and returns its
+// claims. It does not look up the user, use ValidateSession for that.
+func (u *UserRegistration) VerifyAccessToken(accessToken string) (*AccessTokenClaims, error) {
+	t, err := parseJWS(accessToken)
+	if err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	var key *signingKey
+	for i := range u.signingKeys {
+		if u.signingKeys[i].id == t.header.Kid {
+			key = &u.signingKeys[i]
+			break
+		}
+	}
+
+	// the algorithm of the key is used, never the one the token claims to have
+	if key == nil || key.alg != t.header.Alg || t.verify(key.publicKey) != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	claims := new(AccessTokenClaims)
+
+	err = json.Unmarshal(t.payload, claims)
+	if err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	now := time.Now()
+
+	switch {
+	case claims.Issuer != u.accessTokenIssuer,
+		claims.Audience != u.accessTokenAudience,
+		claims.Subject == "",
+		now.After(time.Unix(claims.Expiry, 0).Add(accessTokenClockSkew)),
+		time.Unix(claims.IssuedAt, 0).After(now.Add(accessTokenClockSkew)):
+		return nil, ErrInvalidAccessToken
+	}
+
+	return claims, nil
+}
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+// ContextWithUser returns a copy of the context that holds the authenticated user.
+func ContextWithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns the user stored with ContextWithUser.
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userContextKey).(*User)
+	return user, ok && user != nil
+}
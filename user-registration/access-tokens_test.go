@@ -0,0 +1,359 @@
+package user_registration
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte(strings.Repeat("s", minSecretLength))
+
+func newTestEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// newTestTokenRegistration returns a UserRegistration that issues access tokens with the keys, and a
+// confirmed user to issue them for.
+func newTestTokenRegistration(t *testing.T, keys ...SigningKey) (*UserRegistration, *memoryUserSource, *User) {
+	t.Helper()
+
+	u, users, mail := newTestUserRegistration(t, &NewUserRegistrationConfig{
+		AccessTokenKeys:     keys,
+		AccessTokenIssuer:   "https://app.example",
+		AccessTokenAudience: "api",
+	})
+
+	return u, users, registerConfirmed(t, u, mail, "bob@example.com")
+}
+
+// signTestAccessToken signs the claims with the key, like signAccessToken but with any header and claims.
+func signTestAccessToken(t *testing.T, header jwsHeader, claims AccessTokenClaims, key interface{}) string {
+	t.Helper()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signJWS(header, payload, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestAccessTokens(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []SigningKey{{"hs", testSecret}, {"rs", rsaKey}, {"ed", newTestEd25519Key(t)}} {
+		t.Run(key.ID, func(t *testing.T) {
+			u, _, user := newTestTokenRegistration(t, key)
+
+			tokens, err := u.IssueTokens(context.Background(), user)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tokens.TokenType != "Bearer" || tokens.ExpiresIn != int64(defaultAccessTokenExpiry/time.Second) || tokens.RefreshToken == "" {
+				t.Errorf("tokens %+v", tokens)
+			}
+
+			claims, err := u.VerifyAccessToken(tokens.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if claims.Subject != "bob@example.com" || claims.Issuer != "https://app.example" || claims.Audience != "api" ||
+				claims.SessionVersion != user.SessionVersion || claims.ID == "" {
+				t.Errorf("claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyAccessTokenRejects(t *testing.T) {
+	edKey := newTestEd25519Key(t)
+	u, _, user := newTestTokenRegistration(t, SigningKey{"ed", edKey}, SigningKey{"hs", testSecret})
+
+	now := time.Now()
+	valid := AccessTokenClaims{
+		Issuer:   "https://app.example",
+		Subject:  user.Email,
+		Audience: "api",
+		Expiry:   now.Add(time.Minute).Unix(),
+		IssuedAt: now.Unix(),
+	}
+
+	if _, err := u.VerifyAccessToken(signTestAccessToken(t, jwsHeader{Alg: "EdDSA", Kid: "ed"}, valid, edKey)); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+
+	with := func(change func(c *AccessTokenClaims)) AccessTokenClaims {
+		c := valid
+		change(&c)
+		return c
+	}
+
+	publicKey := []byte(edKey.Public().(ed25519.PublicKey))
+	payload, _ := json.Marshal(valid)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"alg none", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"ed"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString(payload) + "."},
+		// HS256 with the published public key as the secret
+		{"alg of another key", signTestAccessToken(t, jwsHeader{Alg: "HS256", Kid: "ed"}, valid, publicKey)},
+		{"kid of another key", signTestAccessToken(t, jwsHeader{Alg: "EdDSA", Kid: "hs"}, valid, edKey)},
+		{"unknown kid", signTestAccessToken(t, jwsHeader{Alg: "EdDSA", Kid: "other"}, valid, edKey)},
+		{"no kid", signTestAccessToken(t, jwsHeader{Alg: "EdDSA"}, valid, edKey)},
+		{"another key", signTestAccessToken(t, jwsHeader{Alg: "EdDSA", Kid: "ed"}, valid, newTestEd25519Key(t))},
+		{"expired", signTestAccessToken(t, jwsHeader{Alg: "EdDSA", Kid: "ed"}, with(func(c *AccessTokenClaims) {
+			c.Expiry = now.Add(-accessTokenClockSkew - time.Second).Unix()
+		}), edKey)},
+		{"issued in the future", signTestAccessToken(t, jwsHeader{Alg: "EdDSA", Kid: "ed"}, with(func(c *AccessTokenClaims) {
+			c.IssuedAt = now.Add(accessTokenClockSkew + time.Minute).Unix()
+		}), edKey)},
+		{"another issuer", signTestAccessToken(t, jwsHeader{Alg: "EdDSA", Kid: "ed"}, with(func(c *AccessTokenClaims) {
+			c.Issuer = "https://other.example"
+		}), edKey)},
+		{"another audience", signTestAccessToken(t, jwsHeader{Alg: "EdDSA", Kid: "ed"}, with(func(c *AccessTokenClaims) {
+			c.Audience = "other"
+		}), edKey)},
+		{"no subject", signTestAccessToken(t, jwsHeader{Alg: "EdDSA", Kid: "ed"}, with(func(c *AccessTokenClaims) {
+			c.Subject = ""
+		}), edKey)},
+		{"malformed", "not a token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := u.VerifyAccessToken(tt.token)
+			if err != ErrInvalidAccessToken || claims != nil {
+				t.Errorf("claims %v, err %v", claims, err)
+			}
+		})
+	}
+}
+
+func TestAccessTokenKeyRotation(t *testing.T) {
+	oldKey, newKey := newTestEd25519Key(t), newTestEd25519Key(t)
+
+	old, _, user := newTestTokenRegistration(t, SigningKey{"old", oldKey})
+
+	tokens, err := old.IssueTokens(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new key signs, the old one still verifies
+	u, _, _ := newTestTokenRegistration(t, SigningKey{"new", newKey}, SigningKey{"old", oldKey})
+
+	if _, err = u.VerifyAccessToken(tokens.AccessToken); err != nil {
+		t.Errorf("token of the old key: %v", err)
+	}
+
+	set, err := u.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(set.Keys) != 2 || set.Keys[0].Kid != "new" || set.Keys[1].Kid != "old" {
+		t.Errorf("JWKS %+v", set)
+	}
+
+	// a service verifying with the published key
+	parsed, _ := parseJWS(tokens.AccessToken)
+	publicKey, err := set.Keys[1].PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.verify(publicKey) != nil {
+		t.Error("token does not verify with the published key")
+	}
+}
+
+func TestJWKSWithoutSecrets(t *testing.T) {
+	u, _, _ := newTestTokenRegistration(t, SigningKey{"hs", testSecret})
+
+	set, err := u.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(set.Keys) != 0 {
+		t.Errorf("HS256 secret published: %+v", set)
+	}
+}
+
+func TestNewSigningKeys(t *testing.T) {
+	smallRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := [][]SigningKey{
+		{{"", testSecret}},
+		{{"a", testSecret}, {"a", newTestEd25519Key(t)}},
+		{{"a", testSecret[:minSecretLength-1]}},
+		{{"a", smallRSA}},
+		{{"a", ed25519.PrivateKey{1, 2, 3}}},
+		{{"a", "secret"}},
+	}
+
+	for _, keys := range invalid {
+		if _, err := newSigningKeys(keys); err == nil {
+			t.Errorf("%v accepted", keys)
+		}
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	u, _, user := newTestTokenRegistration(t, SigningKey{"hs", testSecret})
+
+	first, err := u.IssueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := u.RefreshTokens(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token not rotated")
+	}
+
+	third, err := u.RefreshTokens(ctx, second.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// using a rotated token again revokes the whole family, also the most recent token
+	_, err = u.RefreshTokens(ctx, first.RefreshToken)
+	if err != ErrRefreshTokenReused {
+		t.Errorf("reused token: err = %v", err)
+	}
+
+	_, err = u.RefreshTokens(ctx, third.RefreshToken)
+	if err != ErrInvalidRefreshToken {
+		t.Errorf("most recent token after reuse: err = %v", err)
+	}
+
+	// another login is a family of its own
+	other, err := u.IssueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = u.RefreshTokens(ctx, other.RefreshToken); err != nil {
+		t.Errorf("token of another login: %v", err)
+	}
+
+	for _, token := range []string{"", "unknown"} {
+		if _, err = u.RefreshTokens(ctx, token); err != ErrInvalidRefreshToken {
+			t.Errorf("%q: err = %v", token, err)
+		}
+	}
+}
+
+func TestRefreshTokenRevoked(t *testing.T) {
+	ctx := context.Background()
+	u, _, user := newTestTokenRegistration(t, SigningKey{"hs", testSecret})
+
+	first, err := u.IssueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := u.RefreshTokens(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// revoking an earlier token of the login revokes the most recent one as well
+	if err = u.RevokeRefreshToken(ctx, first.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = u.RefreshTokens(ctx, second.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Errorf("after revoking: err = %v", err)
+	}
+
+	if err = u.RevokeRefreshToken(ctx, "unknown"); err != nil {
+		t.Errorf("unknown token: %v", err)
+	}
+}
+
+func TestRefreshTokenEndsWithSession(t *testing.T) {
+	ctx := context.Background()
+	u, users, user := newTestTokenRegistration(t, SigningKey{"hs", testSecret})
+
+	tokens, err := u.IssueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// logging out everywhere, e.g. by changing the password
+	user.SessionVersion++
+	if err = users.Update(ctx, *user); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = u.RefreshTokens(ctx, tokens.RefreshToken)
+	if !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("after logging out everywhere: err = %v", err)
+	}
+
+	// deleting the user ends refreshing too
+	tokens, err = u.IssueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = users.Delete(ctx, user.Email); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = u.RefreshTokens(ctx, tokens.RefreshToken)
+	if !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("after deleting the user: err = %v", err)
+	}
+}
+
+func TestAccessTokensDisabled(t *testing.T) {
+	u, _, user := newTestTokenRegistration(t)
+
+	if u.AccessTokensEnabled() {
+		t.Error("enabled without keys")
+	}
+
+	if _, err := u.IssueTokens(context.Background(), user); err == nil {
+		t.Error("tokens issued without keys")
+	}
+
+	if _, err := u.VerifyAccessToken(signTestAccessToken(t, jwsHeader{Alg: "HS256"}, AccessTokenClaims{Subject: "bob"}, testSecret)); err == nil {
+		t.Error("token verified without keys")
+	}
+}
@@ -0,0 +1,165 @@
+package user_registration
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errMailNotSupported = errors.New("mail sender does not support this message")
+
+// ContextlessUserSource is a UserSource as it was before context support was added.
+type ContextlessUserSource interface {
+	Insert(user User) error
+	Update(user User) error
+	Delete(email string) error
+	Select(email string) (*User, error)
+}
+
+// ContextlessMailSender is a MailSender as it was before context support was added.
+// Messages added since are sent when the wrapped sender has a matching method without context.
+type ContextlessMailSender interface {
+	Confirm(email, code string) error
+	Reset(email, code string) error
+}
+
+// WrapUserSource turns a ContextlessUserSource into a UserSource. The context is ignored.
+func WrapUserSource(s ContextlessUserSource) UserSource {
+	return userSourceAdapter{s}
+}
+
+// WrapMailSender turns a ContextlessMailSender into a MailSender. The context is ignored.
+func WrapMailSender(s ContextlessMailSender) MailSender {
+	return mailSenderAdapter{s}
+}
+
+type userSourceAdapter struct {
+	s ContextlessUserSource
+}
+
+func (a userSourceAdapter) Insert(_ context.Context, user User) error {
+	return a.s.Insert(user)
+}
+
+func (a userSourceAdapter) Update(_ context.Context, user User) error {
+	return a.s.Update(user)
+}
+
+func (a userSourceAdapter) Delete(_ context.Context, email string) error {
+	return a.s.Delete(email)
+}
+
+func (a userSourceAdapter) Select(_ context.Context, email string) (*User, error) {
+	return a.s.Select(email)
+}
+
+type mailSenderAdapter struct {
+	s ContextlessMailSender
+}
+
+func (a mailSenderAdapter) Confirm(_ context.Context, email, code string) error {
+	return a.s.Confirm(email, code)
+}
+
+func (a mailSenderAdapter) Reset(_ context.Context, email, code string) error {
+	return a.s.Reset(email, code)
+}
+
+func (a mailSenderAdapter) ConfirmEmailChange(_ context.Context, newEmail, code string) error {
+	s, ok := a.s.(interface {
+		ConfirmEmailChange(newEmail, code string) error
+	})
+	if !ok {
+		return errMailNotSupported
+	}
+
+	return s.ConfirmEmailChange(newEmail, code)
+}
+
+func (a mailSenderAdapter) EmailChanged(_ context.Context, oldEmail, newEmail, revertCode string) error {
+	s, ok := a.s.(interface {
+		EmailChanged(oldEmail, newEmail, revertCode string) error
+	})
+	if !ok {
+		return errMailNotSupported
+	}
+
+	return s.EmailChanged(oldEmail, newEmail, revertCode)
+}
+
+func (a mailSenderAdapter) DeletionScheduled(_ context.Context, email string, deleteAt time.Time) error {
+	s, ok := a.s.(interface {
+		DeletionScheduled(email string, deleteAt time.Time) error
+	})
+	if !ok {
+		return errMailNotSupported
+	}
+
+	return s.DeletionScheduled(email, deleteAt)
+}
+
+func (a mailSenderAdapter) PasswordChanged(_ context.Context, email string) error {
+	s, ok := a.s.(interface {
+		PasswordChanged(email string) error
+	})
+	if !ok {
+		return errMailNotSupported
+	}
+
+	return s.PasswordChanged(email)
+}
+
+func (a mailSenderAdapter) Invite(_ context.Context, email, invitedBy, code string) error {
+	s, ok := a.s.(interface {
+		Invite(email, invitedBy, code string) error
+	})
+	if !ok {
+		return errMailNotSupported
+	}
+
+	return s.Invite(email, invitedBy, code)
+}
+
+func (a mailSenderAdapter) RegistrationApproved(_ context.Context, email string) error {
+	s, ok := a.s.(interface {
+		RegistrationApproved(email string) error
+	})
+	if !ok {
+		return errMailNotSupported
+	}
+
+	return s.RegistrationApproved(email)
+}
+
+func (a mailSenderAdapter) RegistrationRejected(_ context.Context, email, reason string) error {
+	s, ok := a.s.(interface {
+		RegistrationRejected(email, reason string) error
+	})
+	if !ok {
+		return errMailNotSupported
+	}
+
+	return s.RegistrationRejected(email, reason)
+}
+
+func (a mailSenderAdapter) MagicLink(_ context.Context, email, code string) error {
+	s, ok := a.s.(interface {
+		MagicLink(email, code string) error
+	})
+	if !ok {
+		return errMailNotSupported
+	}
+
+	return s.MagicLink(email, code)
+}
+
+func (a mailSenderAdapter) Reauthenticate(_ context.Context, email, code string) error {
+	s, ok := a.s.(interface {
+		Reauthenticate(email, code string) error
+	})
+	if !ok {
+		return errMailNotSupported
+	}
+
+	return s.Reauthenticate(email, code)
+}
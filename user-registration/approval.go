@@ -0,0 +1,174 @@
+package user_registration
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var errNotPendingApproval = errors.New("user is not awaiting approval")
+
+// ApprovalQueue keeps track of the registrations that await approval, so they can be listed.
+type ApprovalQueue interface {
+	Add(ctx context.Context, email string) error
+	Remove(ctx context.Context, email string) error
+	List(ctx context.Context) ([]string, error)
+}
+
+// MemoryApprovalQueue is the default ApprovalQueue. It is lost on restart, use an implementation
+// backed by your database to keep the pending registrations listed.
+type MemoryApprovalQueue struct {
+	mu     sync.Mutex
+	emails map[string]struct{}
+}
+
+func NewMemoryApprovalQueue() *MemoryApprovalQueue {
+	return &MemoryApprovalQueue{
+		emails: make(map[string]struct{}),
+	}
+}
+
+func (q *MemoryApprovalQueue) Add(_ context.Context, email string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.emails[email] = struct{}{}
+
+	return nil
+}
+
+func (q *MemoryApprovalQueue) Remove(_ context.Context, email string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.emails, email)
+
+	return nil
+}
+
+func (q *MemoryApprovalQueue) List(_ context.Context) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	emails := make([]string, 0, len(q.emails))
+	for email := range q.emails {
+		emails = append(emails, email)
+	}
+
+	return emails, nil
+}
+
+// ApprovalRequired reports whether new users have to be approved before they can log in.
+func (u *UserRegistration) ApprovalRequired() bool {
+	return u.approvalRequired
+}
+
+// PendingApprovals returns the users awaiting approval, oldest registration first.
+func (u *UserRegistration) PendingApprovals(ctx context.Context) ([]User, error) {
+	emails, err := u.approvals.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]User, 0, len(emails))
+	for _, email := range emails {
+		user, err := u.userSource.Select(ctx, email)
+		if err != nil {
+			return nil, err
+		}
+
+		// the user may have been deleted or approved elsewhere
+		if user == nil || !user.ApprovalPending {
+			err = u.approvals.Remove(ctx, email)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		users = append(users, *user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+
+	return users, nil
+}
+
+// Approve lets the user awaiting approval log in and sends an e-mail to tell so.
+func (u *UserRegistration) Approve(ctx context.Context, email string) (*User, error) {
+	user, err := u.pendingUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user.ApprovalPending = false
+	user.ApprovedAt = &now
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.approvals.Remove(ctx, user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.HasMailSender() {
+		err = u.mailSender.RegistrationApproved(ctx, user.Address())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// Reject deletes the user awaiting approval and sends an e-mail with the optional reason.
+func (u *UserRegistration) Reject(ctx context.Context, email, reason string) (*User, error) {
+	user, err := u.pendingUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.deleteUser(ctx, user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.approvals.Remove(ctx, user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.HasMailSender() {
+		err = u.mailSender.RegistrationRejected(ctx, user.Address(), reason)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (u *UserRegistration) pendingUser(ctx context.Context, email string) (*User, error) {
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if !user.ApprovalPending {
+		return nil, errNotPendingApproval
+	}
+
+	return user, nil
+}
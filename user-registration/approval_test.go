@@ -0,0 +1,79 @@
+package user_registration
+
+import (
+	"context"
+	"testing"
+)
+
+func TestApproval(t *testing.T) {
+	ctx := context.Background()
+	u, _, mail := newTestUserRegistration(t, &NewUserRegistrationConfig{ApprovalRequired: true})
+
+	registerConfirmed(t, u, mail, "bob@example.com")
+
+	res, err := u.Login(ctx, "bob@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Get(FieldEmail) == nil || res.Get(FieldEmail).Code != CodeAwaitingApproval {
+		t.Fatalf("login before approval: %v", res.Err())
+	}
+
+	pending, err := u.PendingApprovals(ctx)
+	if err != nil || len(pending) != 1 || pending[0].Email != "bob@example.com" {
+		t.Fatalf("pending %v, err %v", pending, err)
+	}
+
+	_, err = u.Approve(ctx, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mail.last("approved") != "bob@example.com" {
+		t.Error("approval not e-mailed")
+	}
+
+	res, err = u.Login(ctx, "bob@example.com", testPassword)
+	if err != nil || !res.OK() {
+		t.Fatalf("login after approval: %v %v", err, res.Err())
+	}
+
+	if pending, _ := u.PendingApprovals(ctx); len(pending) != 0 {
+		t.Errorf("still pending: %v", pending)
+	}
+}
+
+func TestApprovalAdminEmails(t *testing.T) {
+	ctx := context.Background()
+	u, users, mail := newTestUserRegistration(t, &NewUserRegistrationConfig{
+		ApprovalRequired: true,
+		AdminEmails:      []string{"Alice@Example.com"},
+	})
+
+	// a configured admin needs no approval
+	registerConfirmed(t, u, mail, "alice@example.com")
+
+	res, err := u.Login(ctx, "alice@example.com", testPassword)
+	if err != nil || !res.OK() || !res.User.HasRole(RoleAdmin) {
+		t.Fatalf("admin login: %v %v", err, res.Err())
+	}
+
+	// an address added to the AdminEmails after it registered is approved on its next login
+	registerConfirmed(t, u, mail, "bob@example.com")
+
+	u, _, _ = newTestUserRegistration(t, &NewUserRegistrationConfig{
+		ApprovalRequired: true,
+		AdminEmails:      []string{"bob@example.com"},
+	})
+	u.userSource = users
+
+	res, err = u.Login(ctx, "bob@example.com", testPassword)
+	if err != nil || !res.OK() {
+		t.Fatalf("login of a configured admin awaiting approval: %v %v", err, res.Err())
+	}
+
+	user, _ := users.Select(ctx, "bob@example.com")
+	if !user.HasRole(RoleAdmin) || user.ApprovalPending || user.ApprovedAt == nil {
+		t.Errorf("roles %v, pending %v, approved at %v", user.Roles, user.ApprovalPending, user.ApprovedAt)
+	}
+}
@@ -0,0 +1,146 @@
+package user_registration
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const pwnedPrefixLength = 5
+
+// BreachedPasswordChecker reports whether a password is known from data breaches.
+type BreachedPasswordChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// PwnedPasswords is a BreachedPasswordChecker working on a local copy of the Have I Been Pwned
+// Pwned Passwords corpus (SHA-1 version). Only the first 8 bytes of every hash are kept in a sorted
+// index, which keeps the memory use low at a negligible chance of a false positive.
+type PwnedPasswords struct {
+	hashes []uint64
+}
+
+// LoadPwnedPasswords loads the corpus from path, which is either a single file with lines
+// HASH:COUNT or a directory with a file per 5 character hash prefix, containing lines SUFFIX:COUNT,
+// as written by the Pwned Passwords downloader. Hashes seen less than minCount times are skipped.
+func LoadPwnedPasswords(path string, minCount uint) (*PwnedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(PwnedPasswords)
+
+	if !info.IsDir() {
+		err = p.readFile(path, "", minCount)
+		if err != nil {
+			return nil, err
+		}
+
+		p.sort()
+		return p, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		prefix := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if entry.IsDir() || len(prefix) != pwnedPrefixLength {
+			continue
+		}
+
+		if strings.Trim(prefix, "0123456789abcdefABCDEF") != "" {
+			continue
+		}
+
+		err = p.readFile(filepath.Join(path, entry.Name()), prefix, minCount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.sort()
+	return p, nil
+}
+
+func (p *PwnedPasswords) readFile(path, prefix string, minCount uint) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = p.read(f, prefix, minCount)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nil
+}
+
+// read adds the hashes read from r, prefix is prepended to every line.
+func (p *PwnedPasswords) read(r io.Reader, prefix string, minCount uint) error {
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		hash, count, found := strings.Cut(text, ":")
+		if found && minCount > 1 {
+			n, err := strconv.ParseUint(count, 10, 64)
+			if err != nil {
+				return fmt.Errorf("line %d: invalid count", line)
+			}
+
+			if n < uint64(minCount) {
+				continue
+			}
+		}
+
+		b, err := hex.DecodeString(prefix + hash)
+		if err != nil || len(b) != sha1.Size {
+			return fmt.Errorf("line %d: invalid SHA-1 hash", line)
+		}
+
+		p.hashes = append(p.hashes, binary.BigEndian.Uint64(b))
+	}
+
+	return scanner.Err()
+}
+
+func (p *PwnedPasswords) sort() {
+	sort.Slice(p.hashes, func(i, j int) bool {
+		return p.hashes[i] < p.hashes[j]
+	})
+}
+
+// Len returns the number of hashes loaded.
+func (p *PwnedPasswords) Len() int {
+	return len(p.hashes)
+}
+
+func (p *PwnedPasswords) IsBreached(_ context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	h := binary.BigEndian.Uint64(sum[:8])
+
+	i := sort.Search(len(p.hashes), func(i int) bool {
+		return p.hashes[i] >= h
+	})
+
+	return i < len(p.hashes) && p.hashes[i] == h, nil
+}
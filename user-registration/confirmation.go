@@ -0,0 +1,67 @@
+package user_registration
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	defaultConfirmationExpiry = 48 * time.Hour
+	defaultResendInterval     = time.Minute
+)
+
+var (
+	ErrConfirmationCodeExpired = errors.New("confirmation code expired, request a new confirmation e-mail")
+	ErrTooManyRequests         = errors.New("an e-mail was sent to this address only just now, try again later")
+)
+
+// ResendConfirmation sends a new confirmation e-mail, which invalidates the code of the previous one.
+// Nothing is sent when the address is unknown or already confirmed, so this does not reveal which
+// addresses are registered. ErrTooManyRequests is returned when the previous e-mail was sent too recently.
+func (u *UserRegistration) ResendConfirmation(ctx context.Context, email string) error {
+	if !u.HasMailSender() {
+		return errors.New("no e-mail sender configured")
+	}
+
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if user == nil || user.ConfirmedAt != nil {
+		return nil
+	}
+
+	if user.ConfirmationSentAt != nil && time.Since(*user.ConfirmationSentAt) < u.resendInterval {
+		return ErrTooManyRequests
+	}
+
+	token, err := u.newConfirmationToken(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return err
+	}
+
+	return u.mailSender.Confirm(ctx, user.Address(), token)
+}
+
+// newConfirmationToken issues a confirmation token for the user, replacing any previous one.
+func (u *UserRegistration) newConfirmationToken(ctx context.Context, user *User) (string, error) {
+	token, hash, err := u.issueToken(ctx, TokenPurposeConfirm, user.Email, "", u.confirmationExpiry)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	user.ConfirmationCode = ""
+	user.ConfirmationTokenHash = hash
+	user.ConfirmationSentAt = &now
+
+	return token, nil
+}
@@ -0,0 +1,212 @@
+package user_registration
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultDeletionGracePeriod = 14 * 24 * time.Hour
+
+// DeletionSchedule keeps track of the accounts that are scheduled for deletion, so the purger can
+// find them. Due returns the email addresses of the accounts to delete at or before now.
+type DeletionSchedule interface {
+	Schedule(ctx context.Context, email string, at time.Time) error
+	Cancel(ctx context.Context, email string) error
+	Due(ctx context.Context, now time.Time) ([]string, error)
+}
+
+// MemoryDeletionSchedule is the default DeletionSchedule. It is lost on restart, use an implementation
+// backed by your database to make sure scheduled deletions are carried out.
+type MemoryDeletionSchedule struct {
+	mu        sync.Mutex
+	deletions map[string]time.Time
+}
+
+func NewMemoryDeletionSchedule() *MemoryDeletionSchedule {
+	return &MemoryDeletionSchedule{
+		deletions: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryDeletionSchedule) Schedule(_ context.Context, email string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deletions[email] = at
+
+	return nil
+}
+
+func (s *MemoryDeletionSchedule) Cancel(_ context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.deletions, email)
+
+	return nil
+}
+
+func (s *MemoryDeletionSchedule) Due(_ context.Context, now time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var emails []string
+	for email, at := range s.deletions {
+		if !at.After(now) {
+			emails = append(emails, email)
+		}
+	}
+
+	return emails, nil
+}
+
+// RequestDeletion schedules the account for deletion after the grace period, after checking the
+// password. Users without a password pass the code of a link sent by RequestReauthentication instead.
+// All sessions of the user become invalid, logging in during the grace period cancels the deletion.
+func (u *UserRegistration) RequestDeletion(ctx context.Context, email, password string) (*Result, error) {
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	res := new(Result)
+
+	fieldErr, err := u.reauthenticate(ctx, user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if fieldErr != nil {
+		return res.add(fieldErr), nil
+	}
+
+	deleteAt := time.Now().Add(u.deletionGracePeriod)
+	user.DeletionScheduledAt = &deleteAt
+	user.SessionVersion++
+
+	err = u.deletionSchedule.Schedule(ctx, user.Email, deleteAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.HasMailSender() {
+		err = u.mailSender.DeletionScheduled(ctx, user.Address(), deleteAt)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	res.User = user
+
+	return res, nil
+}
+
+// cancelDeletion clears a scheduled deletion of the user and reports whether there was one.
+func (u *UserRegistration) cancelDeletion(ctx context.Context, user *User) (bool, error) {
+	if user.DeletionScheduledAt == nil {
+		return false, nil
+	}
+
+	user.DeletionScheduledAt = nil
+
+	return true, u.deletionSchedule.Cancel(ctx, user.Email)
+}
+
+// deletionDue deletes the user when its grace period is over, the purger may not have run yet.
+func (u *UserRegistration) deletionDue(ctx context.Context, user *User) (bool, error) {
+	if user.DeletionScheduledAt == nil || time.Now().Before(*user.DeletionScheduledAt) {
+		return false, nil
+	}
+
+	err := u.deleteUser(ctx, user.Email)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PurgeDeletedUsers deletes the accounts of which the grace period is over.
+func (u *UserRegistration) PurgeDeletedUsers(ctx context.Context) error {
+	emails, err := u.deletionSchedule.Due(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, email := range emails {
+		user, err := u.userSource.Select(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		// the deletion may have been cancelled on another replica
+		if user == nil || user.DeletionScheduledAt == nil || time.Now().Before(*user.DeletionScheduledAt) {
+			err = u.deletionSchedule.Cancel(ctx, email)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = u.deleteUser(ctx, email)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunDeletionPurger calls PurgeDeletedUsers every interval, until the context is done.
+func (u *UserRegistration) RunDeletionPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := u.PurgeDeletedUsers(ctx)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (u *UserRegistration) deleteUser(ctx context.Context, email string) error {
+	err := u.userSource.Delete(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	return u.deletionSchedule.Cancel(ctx, email)
+}
+
+// ValidateSession returns the current state of the user stored in a session, or nil when the session
+// is no longer valid because the user was deleted, scheduled for deletion or logged out everywhere.
+func (u *UserRegistration) ValidateSession(ctx context.Context, sessionUser User) (*User, error) {
+	user, err := u.userSource.Select(ctx, sessionUser.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || user.SessionVersion != sessionUser.SessionVersion || user.DeletionScheduledAt != nil {
+		return nil, nil
+	}
+
+	return user, nil
+}
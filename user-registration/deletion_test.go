@@ -0,0 +1,84 @@
+package user_registration
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRequestDeletion(t *testing.T) {
+	ctx := context.Background()
+	u, users, mail := newTestUserRegistration(t, nil)
+	registerConfirmed(t, u, mail, "bob@example.com")
+
+	res, err := u.RequestDeletion(ctx, "bob@example.com", "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Get(FieldPassword) == nil {
+		t.Fatal("scheduled with a wrong password")
+	}
+
+	res, err = u.RequestDeletion(ctx, "bob@example.com", testPassword)
+	if err != nil || !res.OK() {
+		t.Fatalf("RequestDeletion: %v %v", err, res.Err())
+	}
+
+	user, _ := users.Select(ctx, "bob@example.com")
+	if user.DeletionScheduledAt == nil {
+		t.Fatal("deletion not scheduled")
+	}
+
+	// logging in during the grace period cancels the deletion
+	res, err = u.Login(ctx, "bob@example.com", testPassword)
+	if err != nil || !res.OK() {
+		t.Fatalf("Login: %v %v", err, res.Err())
+	}
+
+	user, _ = users.Select(ctx, "bob@example.com")
+	if user.DeletionScheduledAt != nil {
+		t.Error("deletion not cancelled by logging in")
+	}
+}
+
+func TestRequestDeletionWithoutPassword(t *testing.T) {
+	ctx := context.Background()
+	u, users, mail := newTestUserRegistration(t, nil)
+
+	// as created by an OpenID Connect login
+	now := time.Now()
+	err := users.Insert(ctx, User{Email: "alice@example.com", CreatedAt: now, ConfirmedAt: &now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a stolen session alone cannot delete the account
+	for _, code := range []string{"", "guess"} {
+		res, err := u.RequestDeletion(ctx, "alice@example.com", code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := res.Get(FieldPassword); e == nil || e.Code != CodeReauthenticationRequired {
+			t.Fatalf("%q: %v", code, res.Err())
+		}
+	}
+
+	if user, _ := users.Select(ctx, "alice@example.com"); user.DeletionScheduledAt != nil {
+		t.Fatal("deletion scheduled without re-authentication")
+	}
+
+	err = u.RequestReauthentication(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := u.RequestDeletion(ctx, "alice@example.com", mail.last("reauthentication"))
+	if err != nil || !res.OK() {
+		t.Fatalf("RequestDeletion: %v %v", err, res.Err())
+	}
+
+	user, _ := users.Select(ctx, "alice@example.com")
+	if user.DeletionScheduledAt == nil {
+		t.Error("deletion not scheduled")
+	}
+}
@@ -0,0 +1,239 @@
+package user_registration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	emailChangeExpiry = 24 * time.Hour
+	emailRevertExpiry = 7 * 24 * time.Hour
+)
+
+var errInvalidEmailChangeCode = errors.New("e-mail change code invalid or expired")
+
+// ChangeEmail starts changing the email address of a user. A confirmation link is sent to the new
+// address, the address is only changed once that link is opened with ConfirmEmailChange.
+// Users without a password pass the code of a link sent by RequestReauthentication instead.
+func (u *UserRegistration) ChangeEmail(ctx context.Context, email, password, newEmail string) (*Result, error) {
+	if !u.HasMailSender() {
+		return nil, errors.New("no e-mail sender configured")
+	}
+
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	res := new(Result)
+
+	newEmail = strings.TrimSpace(newEmail)
+	newKey, err := u.emailNormalizer.Normalize(newEmail)
+	if err != nil {
+		return res.add(newFieldError(FieldNewEmail, CodeInvalidEmail, ErrInvalidEmail)), nil
+	}
+
+	err = u.checkEmailDomain(newKey)
+	if err != nil {
+		return res.add(emailDomainError(FieldNewEmail, err)), nil
+	}
+
+	fieldErr, err := u.reauthenticate(ctx, user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if fieldErr != nil {
+		return res.add(fieldErr), nil
+	}
+
+	if newKey == user.Email {
+		return res.add(newFieldError(FieldNewEmail, CodeEmailUnchanged, ErrEmailUnchanged)), nil
+	}
+
+	other, err := u.selectUser(ctx, newEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	if other != nil {
+		return res.add(newFieldError(FieldNewEmail, CodeEmailTaken, ErrEmailTaken)), nil
+	}
+
+	token, _, err := u.issueToken(ctx, TokenPurposeEmailChange, user.Email, newEmail, emailChangeExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	user.PendingEmail = newEmail
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.mailSender.ConfirmEmailChange(ctx, newEmail, token)
+	if err != nil {
+		return nil, err
+	}
+
+	res.User = user
+
+	return res, nil
+}
+
+// ConfirmEmailChange swaps the email address of the user for the pending one and sends a notice
+// with a link to undo the change to the old address. All sessions of the user become invalid, the
+// returned User carries the new session version.
+func (u *UserRegistration) ConfirmEmailChange(ctx context.Context, code string) (*User, error) {
+	t, err := u.useToken(ctx, TokenPurposeEmailChange, code)
+	if errors.Is(err, errTokenUsed) || errors.Is(err, errTokenExpired) || (err == nil && t == nil) {
+		return nil, errInvalidEmailChangeCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := u.userSource.Select(ctx, t.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	// the token is for the address the link was sent to, which must still be the pending one
+	if user == nil || user.PendingEmail == "" || user.PendingEmail != t.Data {
+		return nil, errInvalidEmailChangeCode
+	}
+
+	// the pending and previous addresses are kept as entered, the key is derived from them
+	email := user.Address()
+	newEmail := user.PendingEmail
+
+	newKey, err := u.emailNormalizer.Normalize(newEmail)
+	if err != nil {
+		return nil, errInvalidEmailChangeCode
+	}
+
+	revertToken, _, err := u.issueToken(ctx, TokenPurposeEmailRevert, newKey, email, emailRevertExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	user.PendingEmail = ""
+	user.PreviousEmail = email
+
+	err = u.moveUser(ctx, user, newKey, newEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.HasMailSender() {
+		err = u.mailSender.EmailChanged(ctx, email, newEmail, revertToken)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	return user, nil
+}
+
+// RevertEmailChange undoes a confirmed email address change, using the link sent to the old address.
+// Like the change itself it ends all sessions of the user, so whoever changed the address is logged out.
+func (u *UserRegistration) RevertEmailChange(ctx context.Context, code string) (*User, error) {
+	t, err := u.useToken(ctx, TokenPurposeEmailRevert, code)
+	if errors.Is(err, errTokenUsed) || errors.Is(err, errTokenExpired) || (err == nil && t == nil) {
+		return nil, errInvalidEmailChangeCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := u.userSource.Select(ctx, t.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || user.PreviousEmail == "" || user.PreviousEmail != t.Data {
+		return nil, errInvalidEmailChangeCode
+	}
+
+	previousEmail := user.PreviousEmail
+
+	previousKey, err := u.emailNormalizer.Normalize(previousEmail)
+	if err != nil {
+		return nil, errInvalidEmailChangeCode
+	}
+
+	user.PreviousEmail = ""
+
+	err = u.moveUser(ctx, user, previousKey, previousEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// moveUser stores the user under a new email address, given normalized and as entered. The email
+// address is the key of the UserSource, so the record is inserted under the new address before the
+// old one is deleted. A scheduled deletion and a pending approval move along. Sessions and refresh
+// tokens are kept by address, so the session version changes to end them all: they must not become
+// valid again when the address is changed back.
+func (u *UserRegistration) moveUser(ctx context.Context, user *User, email, displayEmail string) error {
+	other, err := u.userSource.Select(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if other != nil {
+		return ErrEmailTaken
+	}
+
+	oldEmail, oldDisplayEmail := user.Email, user.DisplayEmail
+	user.Email, user.DisplayEmail = email, displayEmail
+	user.SessionVersion++
+
+	err = u.userSource.Insert(ctx, *user)
+	if err != nil {
+		user.Email, user.DisplayEmail = oldEmail, oldDisplayEmail
+		user.SessionVersion--
+		return err
+	}
+
+	err = u.userSource.Delete(ctx, oldEmail)
+	if err != nil {
+		return err
+	}
+
+	if user.DeletionScheduledAt != nil {
+		err = u.deletionSchedule.Cancel(ctx, oldEmail)
+		if err != nil {
+			return err
+		}
+
+		err = u.deletionSchedule.Schedule(ctx, email, *user.DeletionScheduledAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	if user.ApprovalPending {
+		err = u.approvals.Remove(ctx, oldEmail)
+		if err != nil {
+			return err
+		}
+
+		err = u.approvals.Add(ctx, email)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
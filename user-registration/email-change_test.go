@@ -0,0 +1,189 @@
+package user_registration
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestChangeEmail(t *testing.T) {
+	ctx := context.Background()
+	u, _, mail := newTestUserRegistration(t, nil)
+	registerConfirmed(t, u, mail, "bob@example.com")
+
+	res, err := u.ChangeEmail(ctx, "bob@example.com", "wrong", "robert@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Get(FieldPassword) == nil {
+		t.Fatal("changed with a wrong password")
+	}
+
+	res, err = u.ChangeEmail(ctx, "bob@example.com", testPassword, "robert@example.com")
+	if err != nil || !res.OK() {
+		t.Fatalf("ChangeEmail: %v %v", err, res.Err())
+	}
+
+	user, err := u.ConfirmEmailChange(ctx, mail.last("email-change"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "robert@example.com" || user.PreviousEmail != "bob@example.com" {
+		t.Errorf("after confirming: email %s, previous %s", user.Email, user.PreviousEmail)
+	}
+
+	_, err = u.ConfirmEmailChange(ctx, mail.last("email-change"))
+	if err != errInvalidEmailChangeCode {
+		t.Errorf("confirmed twice: err = %v", err)
+	}
+
+	user, err = u.RevertEmailChange(ctx, mail.last("email-revert"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "bob@example.com" {
+		t.Errorf("after reverting: email %s", user.Email)
+	}
+}
+
+func TestChangeEmailWithoutPassword(t *testing.T) {
+	ctx := context.Background()
+	u, users, mail := newTestUserRegistration(t, nil)
+
+	// as created by an OpenID Connect login
+	now := time.Now()
+	err := users.Insert(ctx, User{Email: "alice@example.com", CreatedAt: now, ConfirmedAt: &now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a stolen session alone cannot move the account to another address
+	for _, code := range []string{"", "guess"} {
+		res, err := u.ChangeEmail(ctx, "alice@example.com", code, "mallory@example.org")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := res.Get(FieldPassword); e == nil || e.Code != CodeReauthenticationRequired {
+			t.Fatalf("%q: %v", code, res.Err())
+		}
+	}
+
+	if mail.last("email-change") != "" {
+		t.Fatal("confirmation sent without re-authentication")
+	}
+
+	err = u.RequestReauthentication(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := u.ChangeEmail(ctx, "alice@example.com", mail.last("reauthentication"), "alice@example.org")
+	if err != nil || !res.OK() {
+		t.Fatalf("ChangeEmail: %v %v", err, res.Err())
+	}
+
+	user, err := u.ConfirmEmailChange(ctx, mail.last("email-change"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "alice@example.org" {
+		t.Errorf("email %s, want alice@example.org", user.Email)
+	}
+}
+
+func TestEmailChangeEndsSessions(t *testing.T) {
+	ctx := context.Background()
+	u, _, mail := newTestUserRegistration(t, &NewUserRegistrationConfig{
+		AccessTokenKeys: []SigningKey{{"hs", testSecret}},
+	})
+	before := *registerConfirmed(t, u, mail, "bob@example.com")
+
+	tokens, err := u.IssueTokens(ctx, &before)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := u.ChangeEmail(ctx, "bob@example.com", testPassword, "robert@example.com")
+	if err != nil || !res.OK() {
+		t.Fatalf("ChangeEmail: %v %v", err, res.Err())
+	}
+
+	changed, err := u.ConfirmEmailChange(ctx, mail.last("email-change"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changedSession := *changed
+
+	if user, _ := u.ValidateSession(ctx, changedSession); user == nil {
+		t.Error("session of the confirmed change invalid")
+	}
+
+	// the owner of the old address changes it back, whoever changed it is logged out
+	reverted, err := u.RevertEmailChange(ctx, mail.last("email-revert"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reverted.Email != "bob@example.com" {
+		t.Fatalf("after reverting: email %s", reverted.Email)
+	}
+
+	for name, session := range map[string]User{"before the change": before, "after the change": changedSession} {
+		if user, _ := u.ValidateSession(ctx, session); user != nil {
+			t.Errorf("session %s still valid", name)
+		}
+	}
+
+	if _, err = u.RefreshTokens(ctx, tokens.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Errorf("refresh token from before the change: err = %v", err)
+	}
+
+	if user, _ := u.ValidateSession(ctx, *reverted); user == nil {
+		t.Error("session of the revert invalid")
+	}
+}
+
+func TestMoveUserMovesRecords(t *testing.T) {
+	ctx := context.Background()
+	u, users, _ := newTestUserRegistration(t, nil)
+
+	now := time.Now()
+	deleteAt := now.Add(time.Hour)
+	user := User{Email: "bob@example.com", CreatedAt: now, ApprovalPending: true, DeletionScheduledAt: &deleteAt}
+
+	err := users.Insert(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = u.deletionSchedule.Schedule(ctx, user.Email, deleteAt); err != nil {
+		t.Fatal(err)
+	}
+	if err = u.approvals.Add(ctx, user.Email); err != nil {
+		t.Fatal(err)
+	}
+
+	err = u.moveUser(ctx, &user, "robert@example.com", "Robert@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := u.deletionSchedule.Due(ctx, deleteAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0] != "robert@example.com" {
+		t.Errorf("deletions scheduled for %v", due)
+	}
+
+	pending, err := u.approvals.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != "robert@example.com" {
+		t.Errorf("approvals pending for %v", pending)
+	}
+
+	if old, _ := users.Select(ctx, "bob@example.com"); old != nil {
+		t.Error("user still stored under the old address")
+	}
+}
@@ -0,0 +1,256 @@
+package user_registration
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrInvalidEmail = errors.New("invalid e-mail address")
+
+// EmailNormalizer turns an email address into the canonical form used as the key of the UserSource,
+// so differently written forms of an address belong to the same account.
+type EmailNormalizer interface {
+	Normalize(email string) (string, error)
+}
+
+// DefaultEmailNormalizer trims the address, lower cases it and converts international domain
+// names to punycode. Optionally aliases of providers are folded onto the same address.
+type DefaultEmailNormalizer struct {
+	PreserveLocalPartCase bool // the local part is lower cased, unless set
+	FoldPlusAddressing    bool // removes a +tag from the local part, e.g. bob+news@example.com
+	FoldGmail             bool // removes dots from the local part of Gmail addresses, which Gmail ignores
+}
+
+func (n *DefaultEmailNormalizer) Normalize(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+
+	local, domain := email[:at], email[at+1:]
+
+	domain, err := toASCIIDomain(domain)
+	if err != nil {
+		return "", err
+	}
+
+	if !n.PreserveLocalPartCase {
+		local = strings.ToLower(local)
+	}
+
+	if n.FoldPlusAddressing {
+		if i := strings.Index(local, "+"); i > 0 {
+			local = local[:i]
+		}
+	}
+
+	if n.FoldGmail && (domain == "gmail.com" || domain == "googlemail.com") {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+
+	return local + "@" + domain, nil
+}
+
+// toASCIIDomain lower cases the domain and converts its labels to punycode where needed.
+func toASCIIDomain(domain string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(domain, "."), ".")
+
+	for i, label := range labels {
+		label = strings.ToLower(label)
+		if label == "" {
+			return "", ErrInvalidEmail
+		}
+
+		for _, r := range label {
+			if unicode.IsSpace(r) || r == '@' || !unicode.IsPrint(r) {
+				return "", ErrInvalidEmail
+			}
+		}
+
+		if !isASCII(label) {
+			encoded, err := punycodeEncode(label)
+			if err != nil {
+				return "", err
+			}
+			label = "xn--" + encoded
+		}
+
+		labels[i] = label
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+// punycode parameters of RFC 3492
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// punycodeEncode implements the encoding of RFC 3492, without the "xn--" prefix.
+func punycodeEncode(s string) (string, error) {
+	runes := []rune(s)
+
+	var out strings.Builder
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out.WriteRune(r)
+		}
+	}
+
+	basic := out.Len()
+	handled := basic
+	if basic > 0 {
+		out.WriteByte('-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+
+	for handled < len(runes) {
+		m := rune(utf8.MaxRune)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+
+		if int(m-n) > (1<<31-1-delta)/(handled+1) {
+			return "", ErrInvalidEmail
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+
+			if r != n {
+				continue
+			}
+
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+
+				if q < t {
+					break
+				}
+
+				out.WriteByte(punycodeDigit(t + (q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+
+			out.WriteByte(punycodeDigit(q))
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+
+		delta++
+		n++
+	}
+
+	return out.String(), nil
+}
+
+func punycodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+
+	return byte('0' + d - 26)
+}
+
+func punycodeAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+// CaseInsensitiveUserSource is implemented by a UserSource that can look up a user ignoring the case of
+// the address. Users of earlier versions are stored under the address as they entered it: with it they
+// are found however the address is written, so it cannot be registered again in another case.
+type CaseInsensitiveUserSource interface {
+	SelectFold(ctx context.Context, email string) (*User, error)
+}
+
+// selectUser looks up a user by the normalized email address. Users of earlier versions, stored
+// under the address as they entered it, are still found by that address, or by any address that
+// normalizes the same when the UserSource implements CaseInsensitiveUserSource.
+func (u *UserRegistration) selectUser(ctx context.Context, email string) (*User, error) {
+	key, err := u.emailNormalizer.Normalize(email)
+	if err == nil {
+		user, err := u.userSource.Select(ctx, key)
+		if err != nil || user != nil {
+			return user, err
+		}
+	}
+
+	entered := strings.TrimSpace(email)
+	if entered == "" {
+		return nil, nil
+	}
+
+	if entered != key {
+		user, err := u.userSource.Select(ctx, entered)
+		if err != nil || user != nil {
+			return user, err
+		}
+	}
+
+	source, ok := u.userSource.(CaseInsensitiveUserSource)
+	if !ok || key == "" {
+		return nil, nil
+	}
+
+	user, err := source.SelectFold(ctx, key)
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	// a normalizer that keeps the case may treat the found address as another account
+	if found, err := u.emailNormalizer.Normalize(user.Email); err != nil || found != key {
+		return nil, nil
+	}
+
+	return user, nil
+}
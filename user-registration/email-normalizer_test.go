@@ -0,0 +1,117 @@
+package user_registration
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// samples of RFC 3492 section 7.1 and well known domain names
+func TestPunycodeEncode(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+		{"Pročprostěnemluvíčesky", "Proprostnemluvesky-uyb24dma41a"},
+		{"3年B組金八先生", "3B-ww4c5e180e575a65lsy2b"},
+		{"安室奈美恵-with-SUPER-MONKEYS", "-with-SUPER-MONKEYS-pc58ag80a8qai00g7n9n"},
+		{"bücher", "bcher-kva"},
+		{"münchen", "mnchen-3ya"},
+		{"пример", "e1afmkfd"},
+	}
+
+	for _, tt := range tests {
+		got, err := punycodeEncode(tt.label)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.label, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultEmailNormalizer(t *testing.T) {
+	tests := []struct {
+		normalizer DefaultEmailNormalizer
+		email      string
+		want       string
+	}{
+		{DefaultEmailNormalizer{}, " Bob@Example.COM ", "bob@example.com"},
+		{DefaultEmailNormalizer{}, "bob@Bücher.example.", "bob@xn--bcher-kva.example"},
+		{DefaultEmailNormalizer{PreserveLocalPartCase: true}, "Bob@Example.com", "Bob@example.com"},
+		{DefaultEmailNormalizer{}, "bob+news@example.com", "bob+news@example.com"},
+		{DefaultEmailNormalizer{FoldPlusAddressing: true}, "bob+news@example.com", "bob@example.com"},
+		{DefaultEmailNormalizer{FoldGmail: true}, "B.o.b@googlemail.com", "bob@gmail.com"},
+		{DefaultEmailNormalizer{FoldGmail: true}, "b.o.b@example.com", "b.o.b@example.com"},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.normalizer.Normalize(tt.email)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.email, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("%q: %s, want %s", tt.email, got, tt.want)
+		}
+	}
+
+	for _, email := range []string{"", "bob", "@example.com", "bob@", "bob@example..com", "bob@exa mple.com"} {
+		if _, err := new(DefaultEmailNormalizer).Normalize(email); err != ErrInvalidEmail {
+			t.Errorf("%q: err = %v, want ErrInvalidEmail", email, err)
+		}
+	}
+}
+
+func TestLegacyEmailKey(t *testing.T) {
+	ctx := context.Background()
+	u, users, _ := newTestUserRegistration(t, nil)
+
+	// stored by an earlier version under the address as entered
+	now := time.Now()
+	err := users.Insert(ctx, User{Email: "Bob@Example.com", CreatedAt: now, ConfirmedAt: &now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, email := range []string{"Bob@Example.com", "bob@example.com", "BOB@EXAMPLE.COM"} {
+		user, err := u.GetUser(ctx, email)
+		if err != nil || user == nil || user.Email != "Bob@Example.com" {
+			t.Errorf("%s: user %v, err %v", email, user, err)
+		}
+
+		res, err := u.Register(ctx, email, testPassword, testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Get(FieldEmail) == nil || res.Get(FieldEmail).Code != CodeEmailTaken {
+			t.Errorf("%s registered next to the legacy user", email)
+		}
+	}
+
+	if count, _ := users.Count(ctx); count != 1 {
+		t.Errorf("%d users, want 1", count)
+	}
+}
+
+func TestLegacyEmailKeyPreservedCase(t *testing.T) {
+	ctx := context.Background()
+	u, users, _ := newTestUserRegistration(t, &NewUserRegistrationConfig{
+		EmailNormalizer: &DefaultEmailNormalizer{PreserveLocalPartCase: true},
+	})
+
+	now := time.Now()
+	err := users.Insert(ctx, User{Email: "bob@example.com", CreatedAt: now, ConfirmedAt: &now})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another account when the case of the local part is kept
+	user, err := u.GetUser(ctx, "Bob@example.com")
+	if err != nil || user != nil {
+		t.Errorf("user %v, err %v", user, err)
+	}
+}
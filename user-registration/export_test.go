@@ -0,0 +1,11 @@
+package user_registration
+
+// exported for the tests in package user_registration_test, which can import oidctest
+
+const TestPassword = testPassword
+
+var NewTestUserRegistration = newTestUserRegistration
+
+func (m *testMailSender) Last(kind string) string {
+	return m.last(kind)
+}
@@ -0,0 +1,219 @@
+package user_registration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultPurgeInterval = 10 * time.Minute
+
+// FileTokenStore is a TokenStore that persists the tokens as json in a single file,
+// so links sent out keep working after a restart. Expired tokens are purged in the background.
+type FileTokenStore struct {
+	mu     sync.Mutex
+	path   string
+	tokens map[string]Token
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewFileTokenStore opens (or creates) the store at path. When purgeInterval is zero a default
+// interval is used. Call Close to stop the background purging.
+func NewFileTokenStore(path string, purgeInterval time.Duration) (*FileTokenStore, error) {
+	if path == "" {
+		return nil, errors.New("path cannot be empty")
+	}
+
+	if purgeInterval <= 0 {
+		purgeInterval = defaultPurgeInterval
+	}
+
+	s := &FileTokenStore{
+		path:   path,
+		tokens: make(map[string]Token),
+		done:   make(chan struct{}),
+	}
+
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Purge()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				err := s.Purge()
+				if err != nil {
+					fmt.Println(err)
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *FileTokenStore) Set(_ context.Context, hash string, token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, existed := s.tokens[hash]
+	s.tokens[hash] = token
+
+	err := s.save()
+	if err != nil {
+		if existed {
+			s.tokens[hash] = old
+		} else {
+			delete(s.tokens, hash)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileTokenStore) Get(_ context.Context, hash string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, nil
+	}
+
+	return &token, nil
+}
+
+func (s *FileTokenStore) Use(_ context.Context, hash string, at time.Time) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, nil
+	}
+
+	if token.SingleUse && token.UsedAt == nil {
+		used := token
+		used.UsedAt = &at
+		s.tokens[hash] = used
+
+		err := s.save()
+		if err != nil {
+			s.tokens[hash] = token
+			return nil, err
+		}
+	}
+
+	return &token, nil
+}
+
+func (s *FileTokenStore) Delete(_ context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil
+	}
+
+	delete(s.tokens, hash)
+
+	err := s.save()
+	if err != nil {
+		s.tokens[hash] = token
+		return err
+	}
+
+	return nil
+}
+
+// Purge removes all expired tokens from the store.
+func (s *FileTokenStore) Purge() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	purged := false
+
+	for hash, token := range s.tokens {
+		if now.After(token.Expiry) {
+			delete(s.tokens, hash)
+			purged = true
+		}
+	}
+
+	if !purged {
+		return nil
+	}
+
+	return s.save()
+}
+
+// Close stops the background purging.
+func (s *FileTokenStore) Close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *FileTokenStore) load() error {
+	d, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(d) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(d, &s.tokens)
+}
+
+// save writes to a temporary file first, so a crash never leaves a half written store behind.
+func (s *FileTokenStore) save() error {
+	d, err := json.Marshal(s.tokens)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(d)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,214 @@
+package user_registration
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryUserSource is a UserSource for tests.
+type memoryUserSource struct {
+	mu    sync.Mutex
+	users map[string]User
+}
+
+func newMemoryUserSource() *memoryUserSource {
+	return &memoryUserSource{users: make(map[string]User)}
+}
+
+func (s *memoryUserSource) Insert(_ context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.Email] = user
+	return nil
+}
+
+func (s *memoryUserSource) Update(_ context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.Email] = user
+	return nil
+}
+
+func (s *memoryUserSource) Delete(_ context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, email)
+	return nil
+}
+
+func (s *memoryUserSource) Select(_ context.Context, email string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[email]
+	if !ok {
+		return nil, nil
+	}
+
+	return &user, nil
+}
+
+func (s *memoryUserSource) SelectFold(_ context.Context, email string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, user := range s.users {
+		if strings.EqualFold(key, email) {
+			return &user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *memoryUserSource) SelectByIdentity(_ context.Context, provider, subject string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if identity := user.identity(provider); identity != nil && identity.Subject == subject {
+			return &user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *memoryUserSource) Count(_ context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.users), nil
+}
+
+// testMailSender keeps the last code sent of each kind of e-mail.
+type testMailSender struct {
+	mu    sync.Mutex
+	codes map[string]string
+}
+
+func (m *testMailSender) add(kind, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.codes == nil {
+		m.codes = make(map[string]string)
+	}
+	m.codes[kind] = code
+	return nil
+}
+
+func (m *testMailSender) last(kind string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.codes[kind]
+}
+
+func (m *testMailSender) Confirm(_ context.Context, _, code string) error {
+	return m.add("confirm", code)
+}
+
+func (m *testMailSender) Reset(_ context.Context, _, code string) error {
+	return m.add("reset", code)
+}
+
+func (m *testMailSender) ConfirmEmailChange(_ context.Context, _, code string) error {
+	return m.add("email-change", code)
+}
+
+func (m *testMailSender) EmailChanged(_ context.Context, _, _, revertCode string) error {
+	return m.add("email-revert", revertCode)
+}
+
+func (m *testMailSender) DeletionScheduled(_ context.Context, _ string, deleteAt time.Time) error {
+	return m.add("deletion", deleteAt.String())
+}
+
+func (m *testMailSender) PasswordChanged(_ context.Context, email string) error {
+	return m.add("password-changed", email)
+}
+
+func (m *testMailSender) Invite(_ context.Context, _, _, code string) error {
+	return m.add("invite", code)
+}
+
+func (m *testMailSender) RegistrationApproved(_ context.Context, email string) error {
+	return m.add("approved", email)
+}
+
+func (m *testMailSender) RegistrationRejected(_ context.Context, _, reason string) error {
+	return m.add("rejected", reason)
+}
+
+func (m *testMailSender) MagicLink(_ context.Context, _, code string) error {
+	return m.add("magic-link", code)
+}
+
+func (m *testMailSender) Reauthenticate(_ context.Context, _, code string) error {
+	return m.add("reauthentication", code)
+}
+
+const testPassword = "Correct-Horse-42"
+
+// newTestUserRegistration returns a UserRegistration with in-memory sources and a fast hasher,
+// completing cfg when given.
+func newTestUserRegistration(t *testing.T, cfg *NewUserRegistrationConfig) (*UserRegistration, *memoryUserSource, *testMailSender) {
+	t.Helper()
+
+	if cfg == nil {
+		cfg = new(NewUserRegistrationConfig)
+	}
+
+	users := newMemoryUserSource()
+	mail := new(testMailSender)
+
+	cfg.UserSource = users
+	cfg.MailSender = mail
+	if cfg.PasswordRequirements == nil {
+		cfg.PasswordRequirements = new(PasswordRequirements)
+	}
+	if cfg.PasswordHasher == nil {
+		cfg.PasswordHasher = &ScryptHasher{LogN: 4}
+	}
+
+	u, err := NewUserRegistration(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u, users, mail
+}
+
+// registerConfirmed registers the address with testPassword and confirms it.
+func registerConfirmed(t *testing.T, u *UserRegistration, mail *testMailSender, email string) *User {
+	t.Helper()
+
+	ctx := context.Background()
+
+	res, err := u.Register(ctx, email, testPassword, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.OK() {
+		t.Fatalf("register %s: %v", email, res.Err())
+	}
+
+	err = u.Confirm(ctx, mail.last("confirm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := u.GetUser(ctx, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
@@ -0,0 +1,136 @@
+package user_registration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const defaultInvitationExpiry = 7 * 24 * time.Hour
+
+var ErrInvalidInvitation = errors.New("invitation invalid or expired")
+
+// Invitation invites someone to register, the new user gets the preset Properties and Roles.
+type Invitation struct {
+	Email      string            `json:"email"`
+	InvitedBy  string            `json:"invited_by,omitempty"` // optional, the email address of the inviting user
+	Expiry     time.Duration     `json:"-"`                    // optional, defaults to the InvitationExpiry of the config
+	Properties map[string]string `json:"properties,omitempty"`
+	Roles      []string          `json:"roles,omitempty"`
+}
+
+// Invite sends an invitation link to the email address. Registering through the link confirms the
+// address, also in invite-only mode.
+func (u *UserRegistration) Invite(ctx context.Context, invitation Invitation) (*Result, error) {
+	if !u.HasMailSender() {
+		return nil, errors.New("no e-mail sender configured")
+	}
+
+	res := new(Result)
+
+	invitation.Email = strings.TrimSpace(invitation.Email)
+
+	key, err := u.emailNormalizer.Normalize(invitation.Email)
+	if err != nil {
+		return res.add(newFieldError(FieldEmail, CodeInvalidEmail, ErrInvalidEmail)), nil
+	}
+
+	err = u.checkEmailDomain(key)
+	if err != nil {
+		return res.add(emailDomainError(FieldEmail, err)), nil
+	}
+
+	user, err := u.selectUser(ctx, invitation.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user != nil {
+		return res.add(newFieldError(FieldEmail, CodeEmailTaken, ErrEmailTaken)), nil
+	}
+
+	expiry := invitation.Expiry
+	if expiry == 0 {
+		expiry = u.invitationExpiry
+	}
+
+	data, err := json.Marshal(invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	token, _, err := u.issueToken(ctx, TokenPurposeInvitation, key, string(data), expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.mailSender.Invite(ctx, invitation.Email, invitation.InvitedBy, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ValidateInvitation returns the invitation of a code, so the register page can show the invited address.
+func (u *UserRegistration) ValidateInvitation(ctx context.Context, code string) (*Invitation, error) {
+	t, _, err := u.lookupToken(ctx, TokenPurposeInvitation, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if t == nil || t.UsedAt != nil || time.Now().After(t.Expiry) {
+		return nil, ErrInvalidInvitation
+	}
+
+	invitation := new(Invitation)
+
+	err = json.Unmarshal([]byte(t.Data), invitation)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// AcceptInvitation registers the invited user. The invitation link proves the address, so the
+// user is confirmed right away.
+func (u *UserRegistration) AcceptInvitation(ctx context.Context, code, password, confirmPassword string) (*Result, error) {
+	invitation, err := u.ValidateInvitation(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.register(ctx, invitation.Email, password, confirmPassword, invitation, code)
+}
+
+// InviteOnly reports whether registration is only possible with an invitation.
+func (u *UserRegistration) InviteOnly() bool {
+	return u.inviteOnly
+}
+
+// acceptInvitation uses up the invitation code and applies the invitation to the new user.
+func (u *UserRegistration) acceptInvitation(ctx context.Context, user *User, invitation *Invitation, code string) error {
+	t, err := u.useToken(ctx, TokenPurposeInvitation, code)
+	if errors.Is(err, errTokenUsed) || errors.Is(err, errTokenExpired) || (err == nil && t == nil) {
+		return ErrInvalidInvitation
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.ConfirmedAt = &now
+	user.Roles = invitation.Roles
+
+	if len(invitation.Properties) > 0 {
+		user.Properties = make(map[string]string, len(invitation.Properties))
+		for k, v := range invitation.Properties {
+			user.Properties[k] = v
+		}
+	}
+
+	return nil
+}
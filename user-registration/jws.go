@@ -0,0 +1,288 @@
+package user_registration
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var ErrInvalidSignature = errors.New("invalid token signature")
+
+// JSONWebKey is a public key in the JWK format of RFC 7517, as published at a JWKS endpoint.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the document of a JWKS endpoint.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// NewJSONWebKey returns the JWK of an RSA, P-256 or Ed25519 public key, for signing with RS256, ES256 or EdDSA.
+func NewJSONWebKey(kid string, key crypto.PublicKey) (JSONWebKey, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return JSONWebKey{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return JSONWebKey{}, errors.New("only P-256 ECDSA keys are supported")
+		}
+
+		return JSONWebKey{
+			Kty: "EC",
+			Kid: kid,
+			Use: "sig",
+			Alg: "ES256",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, 32))),
+		}, nil
+	case ed25519.PublicKey:
+		return JSONWebKey{
+			Kty: "OKP",
+			Kid: kid,
+			Use: "sig",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}, nil
+	}
+
+	return JSONWebKey{}, fmt.Errorf("unsupported key type %T", key)
+}
+
+// PublicKey returns the key as *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid P-256 point")
+		}
+
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// jws is a token in the JWS compact serialization: header.payload.signature
+type jws struct {
+	header       jwsHeader
+	payload      []byte
+	signingInput string
+	signature    []byte
+}
+
+func parseJWS(token string) (*jws, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	h, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+
+	t := new(jws)
+
+	err = json.Unmarshal(h, &t.header)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+
+	t.payload, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token payload: %w", err)
+	}
+
+	t.signature, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	t.signingInput = parts[0] + "." + parts[1]
+
+	return t, nil
+}
+
+// signJWS returns the payload as a JWS signed with the key, which has to fit the algorithm in the header:
+// a []byte secret for HS256, an *rsa.PrivateKey for RS256 or an ed25519.PrivateKey for EdDSA.
+func signJWS(header jwsHeader, payload []byte, key interface{}) (string, error) {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	switch header.Alg {
+	case "HS256":
+		k, ok := key.([]byte)
+		if !ok {
+			return "", errors.New("HS256 requires a []byte secret")
+		}
+
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case "RS256":
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return "", errors.New("RS256 requires an *rsa.PrivateKey")
+		}
+
+		digest := sha256.Sum256([]byte(input))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", err
+		}
+	case "EdDSA":
+		k, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return "", errors.New("EdDSA requires an ed25519.PrivateKey")
+		}
+
+		sig = ed25519.Sign(k, []byte(input))
+	default:
+		return "", fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// verify checks the signature with the key, which has to fit the algorithm in the header.
+// HS256 is only verified with a []byte secret, so it cannot be used with a public key from a JWKS.
+func (t *jws) verify(key crypto.PublicKey) error {
+	switch t.header.Alg {
+	case "HS256":
+		k, ok := key.([]byte)
+		if !ok || len(k) == 0 {
+			return ErrInvalidSignature
+		}
+
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(t.signingInput))
+		if !hmac.Equal(mac.Sum(nil), t.signature) {
+			return ErrInvalidSignature
+		}
+	case "RS256":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+
+		digest := sha256.Sum256([]byte(t.signingInput))
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], t.signature) != nil {
+			return ErrInvalidSignature
+		}
+	case "ES256":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(t.signature) != 64 {
+			return ErrInvalidSignature
+		}
+
+		digest := sha256.Sum256([]byte(t.signingInput))
+		r := new(big.Int).SetBytes(t.signature[:32])
+		s := new(big.Int).SetBytes(t.signature[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(k, []byte(t.signingInput), t.signature) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", t.header.Alg)
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package user_registration
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSignAndVerifyJWS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte(strings.Repeat("s", 32))
+
+	tests := []struct {
+		alg       string
+		key       interface{}
+		publicKey interface{}
+	}{
+		{"HS256", secret, secret},
+		{"RS256", rsaKey, &rsaKey.PublicKey},
+		{"EdDSA", edKey, edKey.Public()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			token, err := signJWS(jwsHeader{Alg: tt.alg, Kid: "k"}, []byte(`{"sub":"bob"}`), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := parseJWS(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if parsed.header.Kid != "k" || string(parsed.payload) != `{"sub":"bob"}` {
+				t.Errorf("header %v, payload %s", parsed.header, parsed.payload)
+			}
+
+			if err = parsed.verify(tt.publicKey); err != nil {
+				t.Errorf("verify: %v", err)
+			}
+
+			// another payload with the same signature
+			parts := strings.Split(token, ".")
+			tampered, err := parseJWS(parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"eve"}`)) + "." + parts[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tampered.verify(tt.publicKey) != ErrInvalidSignature {
+				t.Error("tampered payload verified")
+			}
+		})
+	}
+}
+
+func TestVerifyJWSES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{}`))
+	digest := sha256.Sum256([]byte(input))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	parsed, err := parseJWS(input + "." + base64.RawURLEncoding.EncodeToString(sig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = parsed.verify(&key.PublicKey); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+}
+
+func TestVerifyJWSAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk, err := NewJSONWebKey("k", &rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 signed with the public key as the secret, as published in the JWKS
+	token, err := signJWS(jwsHeader{Alg: "HS256"}, []byte(`{}`), []byte(jwk.N))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _ := parseJWS(token)
+	if parsed.verify(&rsaKey.PublicKey) == nil {
+		t.Error("HS256 verified with an RSA public key")
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + "."
+	parsed, err = parseJWS(unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.verify(&rsaKey.PublicKey) == nil || parsed.verify([]byte("secret")) == nil {
+		t.Error("unsigned token verified")
+	}
+
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	token, _ = signJWS(jwsHeader{Alg: "EdDSA"}, []byte(`{}`), edKey)
+	parsed, _ = parseJWS(token)
+	if parsed.verify(&rsaKey.PublicKey) == nil {
+		t.Error("EdDSA verified with an RSA key")
+	}
+
+	for _, malformed := range []string{"", "a.b", "a.b.c.d", "!.e30.", "e30.!.", "e30.e30.!"} {
+		if _, err := parseJWS(malformed); err == nil {
+			t.Errorf("%q parsed", malformed)
+		}
+	}
+}
+
+func TestJSONWebKeyRoundTrip(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	for _, key := range []interface{}{&rsaKey.PublicKey, &ecKey.PublicKey, edPublic} {
+		jwk, err := NewJSONWebKey("k", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := jwk.PublicKey()
+		if err != nil {
+			t.Fatalf("%s: %v", jwk.Kty, err)
+		}
+
+		if !reflect.DeepEqual(got, key) {
+			t.Errorf("%s: key changed in the round trip", jwk.Kty)
+		}
+	}
+
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if _, err := NewJSONWebKey("k", &p384.PublicKey); err == nil {
+		t.Error("P-384 key accepted")
+	}
+}
+
+func TestFindJSONWebKey(t *testing.T) {
+	keys := []JSONWebKey{
+		{Kid: "a", Alg: "RS256", Use: "sig"},
+		{Kid: "b", Alg: "RS256", Use: "enc"},
+		{Kid: "c", Alg: "ES256"},
+	}
+
+	tests := []struct {
+		kid, alg string
+		want     string
+	}{
+		{"a", "RS256", "a"},
+		{"a", "ES256", ""}, // the algorithm of the key has to match
+		{"b", "RS256", ""}, // not a signing key
+		{"", "ES256", "c"}, // the only fitting key
+		{"x", "RS256", ""},
+	}
+
+	for _, tt := range tests {
+		got := findJSONWebKey(keys, tt.kid, tt.alg)
+		if (got == nil) != (tt.want == "") || got != nil && got.Kid != tt.want {
+			t.Errorf("kid %q alg %s: %v, want %q", tt.kid, tt.alg, got, tt.want)
+		}
+	}
+
+	// without a kid more than one fitting key is ambiguous
+	if got := findJSONWebKey(append(keys, JSONWebKey{Kid: "d", Alg: "ES256"}), "", "ES256"); got != nil {
+		t.Errorf("ambiguous key found: %v", got)
+	}
+}
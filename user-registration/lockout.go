@@ -0,0 +1,76 @@
+package user_registration
+
+import "time"
+
+const (
+	defaultMaxFailedLogins uint          = 5
+	defaultLockoutDuration time.Duration = 5 * time.Minute
+	defaultMaxLockout      time.Duration = 24 * time.Hour
+)
+
+// LockoutPolicy locks an account after MaxFailedLogins consecutive failed logins. The first lockout
+// lasts Duration, every further failure doubles it up to MaxDuration. A successful login or a
+// password reset unlocks the account.
+type LockoutPolicy struct {
+	MaxFailedLogins uint          // default 5
+	Duration        time.Duration // default 5 minutes
+	MaxDuration     time.Duration // default 24 hours
+}
+
+func (p *LockoutPolicy) lockoutDuration(failedLogins uint) time.Duration {
+	maxFailedLogins := defaultMaxFailedLogins
+	if p.MaxFailedLogins != 0 {
+		maxFailedLogins = p.MaxFailedLogins
+	}
+
+	if failedLogins < maxFailedLogins {
+		return 0
+	}
+
+	d := defaultLockoutDuration
+	if p.Duration != 0 {
+		d = p.Duration
+	}
+
+	maxDuration := defaultMaxLockout
+	if p.MaxDuration != 0 {
+		maxDuration = p.MaxDuration
+	}
+
+	for i := maxFailedLogins; i < failedLogins && d < maxDuration; i++ {
+		d *= 2
+	}
+
+	if d > maxDuration {
+		d = maxDuration
+	}
+
+	return d
+}
+
+// registerFailedLogin counts the failure and locks the user when the policy says so.
+func (p *LockoutPolicy) registerFailedLogin(user *User) {
+	user.FailedLogins++
+
+	d := p.lockoutDuration(user.FailedLogins)
+	if d > 0 {
+		lockedUntil := time.Now().Add(d)
+		user.LockedUntil = &lockedUntil
+	}
+}
+
+func (u *User) isLocked() bool {
+	return u.LockedUntil != nil && time.Now().Before(*u.LockedUntil)
+}
+
+// unlock resets the lockout state and reports whether anything changed.
+func (u *User) unlock() bool {
+	if u.FailedLogins == 0 && u.LockedUntil == nil {
+		return false
+	}
+
+	u.FailedLogins = 0
+	u.LockedUntil = nil
+
+	return true
+}
@@ -0,0 +1,152 @@
+package user_registration
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const defaultMagicLinkExpiry = 15 * time.Minute
+
+// MagicLinkMode sets whether users can log in with a link sent by e-mail.
+type MagicLinkMode int
+
+const (
+	MagicLinkDisabled MagicLinkMode = iota
+	MagicLinkAlongsidePassword
+	MagicLinkInsteadOfPassword // Login with a password is rejected, the password is still needed to change the account
+)
+
+var (
+	ErrInvalidMagicLink      = errors.New("sign-in link invalid or expired, request a new one")
+	ErrPasswordLoginDisabled = errors.New("logging in with a password is disabled, request a sign-in link instead")
+)
+
+// MagicLinkMode returns whether users can log in with a link sent by e-mail.
+func (u *UserRegistration) MagicLinkMode() MagicLinkMode {
+	return u.magicLinkMode
+}
+
+// RequestMagicLink sends a single-use sign-in link to the address. Nothing is sent when the address is
+// unknown, so this does not reveal which addresses are registered. ErrTooManyRequests is returned when
+// the previous link was sent too recently.
+func (u *UserRegistration) RequestMagicLink(ctx context.Context, email string) error {
+	if u.magicLinkMode == MagicLinkDisabled {
+		return errors.New("sign-in links are disabled")
+	}
+
+	if !u.HasMailSender() {
+		return errors.New("no e-mail sender configured")
+	}
+
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	if user.MagicLinkSentAt != nil && time.Since(*user.MagicLinkSentAt) < u.resendInterval {
+		return ErrTooManyRequests
+	}
+
+	token, _, err := u.issueToken(ctx, TokenPurposeMagicLink, user.Email, "", u.magicLinkExpiry)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.MagicLinkSentAt = &now
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return err
+	}
+
+	return u.mailSender.MagicLink(ctx, user.Address(), token)
+}
+
+// LoginWithMagicLink logs in the user of a sign-in link. Like Login it can require the second factor.
+func (u *UserRegistration) LoginWithMagicLink(ctx context.Context, code string) (*Result, error) {
+	if u.magicLinkMode == MagicLinkDisabled {
+		return nil, errors.New("sign-in links are disabled")
+	}
+
+	t, err := u.useToken(ctx, TokenPurposeMagicLink, code)
+	if errors.Is(err, errTokenUsed) || errors.Is(err, errTokenExpired) || (err == nil && t == nil) {
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := u.userSource.Select(ctx, t.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user != nil {
+		deleted, err := u.deletionDue(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+
+		if deleted {
+			user = nil
+		}
+	}
+
+	if user == nil {
+		return nil, ErrInvalidMagicLink
+	}
+
+	return u.loginVerifiedUser(ctx, user)
+}
+
+// loginVerifiedUser logs in a user that has proven to own the address, which confirms it and unlocks the account.
+func (u *UserRegistration) loginVerifiedUser(ctx context.Context, user *User) (*Result, error) {
+	var err error
+	res := new(Result)
+
+	if user.ConfirmedAt == nil {
+		now := time.Now()
+		user.ConfirmedAt = &now
+		user.ConfirmationCode = ""
+		user.ConfirmationTokenHash = ""
+	}
+
+	u.grantConfiguredAdmin(user)
+
+	if user.ApprovalPending {
+		err = u.userSource.Update(ctx, *user)
+		if err != nil {
+			return nil, err
+		}
+
+		return res.add(newFieldError(FieldEmail, CodeAwaitingApproval, ErrAwaitingApproval)), nil
+	}
+
+	// with two-factor authentication the lockout is only reset once the second factor is verified
+	twoFactorRequired := user.TOTPEnabledAt != nil
+	if !twoFactorRequired {
+		user.unlock()
+
+		res.DeletionCancelled, err = u.cancelDeletion(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	// with TwoFactorRequired the user is set as well, VerifyTwoFactor needs its address
+	res.TwoFactorRequired = twoFactorRequired
+	res.User = user
+
+	return res, nil
+}
@@ -0,0 +1,42 @@
+package user_registration
+
+import (
+	"context"
+	"testing"
+)
+
+// Like Confirm, a sign-in link confirms an unconfirmed user and keeps its password.
+func TestLoginWithMagicLinkUnconfirmed(t *testing.T) {
+	ctx := context.Background()
+	u, users, mail := newTestUserRegistration(t, &NewUserRegistrationConfig{MagicLink: MagicLinkAlongsidePassword})
+
+	res, err := u.Register(ctx, "bob@example.com", testPassword, testPassword)
+	if err != nil || !res.OK() {
+		t.Fatalf("Register: %v %v", err, res.Err())
+	}
+
+	before, _ := users.Select(ctx, "bob@example.com")
+
+	err = u.RequestMagicLink(ctx, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = u.LoginWithMagicLink(ctx, mail.last("magic-link"))
+	if err != nil || !res.OK() {
+		t.Fatalf("LoginWithMagicLink: %v %v", err, res.Err())
+	}
+
+	user, _ := users.Select(ctx, "bob@example.com")
+	if user.ConfirmedAt == nil {
+		t.Error("not confirmed")
+	}
+	if user.Password != before.Password || user.SessionVersion != before.SessionVersion {
+		t.Error("credentials changed")
+	}
+
+	res, err = u.Login(ctx, "bob@example.com", testPassword)
+	if err != nil || !res.OK() {
+		t.Errorf("Login: %v %v", err, res.Err())
+	}
+}
@@ -1,6 +1,20 @@
 package user_registration
 
+import (
+	"context"
+	"time"
+)
+
 type MailSender interface {
-	Confirm(email, code string) error
-	Reset(email, code string) error
+	Confirm(ctx context.Context, email, code string) error
+	Reset(ctx context.Context, email, code string) error
+	ConfirmEmailChange(ctx context.Context, newEmail, code string) error
+	EmailChanged(ctx context.Context, oldEmail, newEmail, revertCode string) error
+	DeletionScheduled(ctx context.Context, email string, deleteAt time.Time) error
+	PasswordChanged(ctx context.Context, email string) error
+	Invite(ctx context.Context, email, invitedBy, code string) error
+	RegistrationApproved(ctx context.Context, email string) error
+	RegistrationRejected(ctx context.Context, email, reason string) error
+	MagicLink(ctx context.Context, email, code string) error
+	Reauthenticate(ctx context.Context, email, code string) error
 }
@@ -0,0 +1,507 @@
+package user_registration
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcAuthRequestExpiry = 10 * time.Minute
+	oidcClockSkew         = time.Minute
+	oidcKeysRefetchAfter  = time.Minute
+)
+
+var (
+	ErrOIDCEmailNotVerified = errors.New("the e-mail address of this account has not been verified by the provider")
+	ErrOIDCIdentityMismatch = errors.New("another account of this provider is linked to this e-mail address")
+	errInvalidOIDCState     = errors.New("invalid or expired login attempt, try again")
+)
+
+// OIDCProvider configures an OpenID Connect provider to log in with.
+type OIDCProvider struct {
+	Name         string // identifies the provider in the linked identities, e.g. "google"
+	DisplayName  string // optional, shown to users, defaults to Name
+	Issuer       string // the discovery document is read from Issuer + "/.well-known/openid-configuration"
+	ClientID     string
+	ClientSecret string   // optional for public clients, which only rely on PKCE
+	RedirectURL  string   // the callback that passes the code and state to Exchange
+	Scopes       []string // optional, defaults to openid, email and profile
+}
+
+func (p OIDCProvider) displayName() string {
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+
+	return p.Name
+}
+
+// LinkedIdentity is an account of an OpenID Connect provider that the user logs in with.
+type LinkedIdentity struct {
+	Provider string
+	Subject  string
+	Email    string
+	LinkedAt time.Time
+}
+
+// OIDCAuthRequest holds the secrets of a login that is sent to the provider. Store it, e.g. in the
+// session, and pass it to Exchange when the provider redirects back.
+type OIDCAuthRequest struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	CreatedAt    time.Time
+}
+
+// OIDCClaims are the claims of a verified ID token.
+type OIDCClaims struct {
+	Issuer        string       `json:"iss"`
+	Subject       string       `json:"sub"`
+	Audience      oidcAudience `json:"aud"`
+	AuthorizedBy  string       `json:"azp"`
+	Expiry        int64        `json:"exp"`
+	IssuedAt      int64        `json:"iat"`
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified oidcBool     `json:"email_verified"`
+	Name          string       `json:"name"`
+}
+
+// oidcAudience is the aud claim, which is a single string or an array of strings.
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = []string{s}
+		return nil
+	}
+
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+// oidcBool is a boolean claim, which some providers send as a string.
+type oidcBool bool
+
+func (v *oidcBool) UnmarshalJSON(b []byte) error {
+	*v = oidcBool(strings.Trim(string(b), `"`) == "true")
+	return nil
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCClient logs in with an OpenID Connect provider using the authorization code flow with PKCE.
+type OIDCClient struct {
+	provider      OIDCProvider
+	httpClient    *http.Client
+	discovery     oidcDiscovery
+	mu            sync.Mutex
+	keys          []JSONWebKey
+	keysFetchedAt time.Time
+}
+
+// NewOIDCClient reads the discovery document of the provider. The httpClient is optional.
+func NewOIDCClient(ctx context.Context, provider OIDCProvider, httpClient *http.Client) (*OIDCClient, error) {
+	if provider.Name == "" || provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+		return nil, errors.New("OIDCProvider needs a Name, Issuer, ClientID and RedirectURL")
+	}
+
+	if len(provider.Scopes) == 0 {
+		provider.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	c := &OIDCClient{
+		provider:   provider,
+		httpClient: httpClient,
+	}
+
+	err := c.getJSON(ctx, strings.TrimSuffix(provider.Issuer, "/")+"/.well-known/openid-configuration", &c.discovery)
+	if err != nil {
+		return nil, fmt.Errorf("discovery of %s: %w", provider.Name, err)
+	}
+
+	if c.discovery.Issuer != provider.Issuer {
+		return nil, fmt.Errorf("discovery of %s: issuer %s does not match %s", provider.Name, c.discovery.Issuer, provider.Issuer)
+	}
+
+	if c.discovery.AuthorizationEndpoint == "" || c.discovery.TokenEndpoint == "" || c.discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery of %s: incomplete discovery document", provider.Name)
+	}
+
+	return c, nil
+}
+
+func (c *OIDCClient) Name() string {
+	return c.provider.Name
+}
+
+func (c *OIDCClient) DisplayName() string {
+	return c.provider.displayName()
+}
+
+// AuthCodeURL returns the URL to send the user to, and the request to keep until the provider redirects back.
+func (c *OIDCClient) AuthCodeURL() (string, OIDCAuthRequest, error) {
+	state, _, err := newToken()
+	if err != nil {
+		return "", OIDCAuthRequest{}, err
+	}
+
+	nonce, _, err := newToken()
+	if err != nil {
+		return "", OIDCAuthRequest{}, err
+	}
+
+	verifier, _, err := newToken()
+	if err != nil {
+		return "", OIDCAuthRequest{}, err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", c.provider.ClientID)
+	q.Set("redirect_uri", c.provider.RedirectURL)
+	q.Set("scope", strings.Join(c.provider.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(c.discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return c.discovery.AuthorizationEndpoint + sep + q.Encode(), OIDCAuthRequest{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+// Exchange checks the state the provider redirected back with, redeems the code and returns the
+// claims of the verified ID token.
+func (c *OIDCClient) Exchange(ctx context.Context, req OIDCAuthRequest, state, code string) (*OIDCClaims, error) {
+	if req.State == "" || subtle.ConstantTimeCompare([]byte(req.State), []byte(state)) != 1 ||
+		time.Since(req.CreatedAt) > oidcAuthRequestExpiry {
+		return nil, errInvalidOIDCState
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.provider.RedirectURL)
+	form.Set("code_verifier", req.CodeVerifier)
+
+	if c.provider.ClientSecret == "" {
+		form.Set("client_id", c.provider.ClientID)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, c.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/json")
+
+	if c.provider.ClientSecret != "" {
+		r.SetBasicAuth(url.QueryEscape(c.provider.ClientID), url.QueryEscape(c.provider.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	err = c.doJSON(r, &token)
+	if err != nil && token.Error == "" {
+		return nil, fmt.Errorf("token request to %s: %w", c.provider.Name, err)
+	}
+
+	if token.Error != "" {
+		return nil, fmt.Errorf("token request to %s: %s %s", c.provider.Name, token.Error, token.ErrorDescription)
+	}
+
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("token request to %s: no id_token returned", c.provider.Name)
+	}
+
+	return c.verifyIDToken(ctx, token.IDToken, req.Nonce)
+}
+
+// verifyIDToken checks the signature against the keys of the provider, and the issuer, audience,
+// expiry and nonce of the ID token.
+func (c *OIDCClient) verifyIDToken(ctx context.Context, idToken, nonce string) (*OIDCClaims, error) {
+	t, err := parseJWS(idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := c.key(ctx, t.header.Kid, t.header.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.verify(key)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := new(OIDCClaims)
+
+	err = json.Unmarshal(t.payload, claims)
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token: %w", err)
+	}
+
+	now := time.Now()
+
+	switch {
+	case claims.Issuer != c.discovery.Issuer:
+		return nil, errors.New("ID token of another issuer")
+	case !contains(claims.Audience, c.provider.ClientID):
+		return nil, errors.New("ID token for another client")
+	case len(claims.Audience) > 1 && claims.AuthorizedBy != c.provider.ClientID:
+		return nil, errors.New("ID token authorized by another client")
+	case now.After(time.Unix(claims.Expiry, 0).Add(oidcClockSkew)):
+		return nil, errors.New("ID token expired")
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(oidcClockSkew)):
+		return nil, errors.New("ID token issued in the future")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, errors.New("ID token for another login attempt")
+	case claims.Subject == "":
+		return nil, errors.New("ID token without subject")
+	}
+
+	return claims, nil
+}
+
+// key returns the public key with the kid from the JWKS of the provider, which is fetched again
+// when the key is unknown, since providers rotate their keys.
+func (c *OIDCClient) key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := findJSONWebKey(c.keys, kid, alg)
+	if k == nil && time.Since(c.keysFetchedAt) > oidcKeysRefetchAfter {
+		var set JSONWebKeySet
+
+		err := c.getJSON(ctx, c.discovery.JWKSURI, &set)
+		if err != nil {
+			return nil, fmt.Errorf("keys of %s: %w", c.provider.Name, err)
+		}
+
+		c.keys = set.Keys
+		c.keysFetchedAt = time.Now()
+
+		k = findJSONWebKey(c.keys, kid, alg)
+	}
+
+	if k == nil {
+		return nil, fmt.Errorf("unknown signing key %q of %s", kid, c.provider.Name)
+	}
+
+	return k.PublicKey()
+}
+
+// findJSONWebKey returns the signing key with the kid, or the only one fitting the algorithm when there is no kid.
+func findJSONWebKey(keys []JSONWebKey, kid, alg string) *JSONWebKey {
+	var found *JSONWebKey
+	for i, k := range keys {
+		if (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != alg) {
+			continue
+		}
+
+		if kid != "" {
+			if k.Kid == kid {
+				return &keys[i]
+			}
+			continue
+		}
+
+		if found != nil {
+			return nil
+		}
+		found = &keys[i]
+	}
+
+	return found
+}
+
+func (c *OIDCClient) getJSON(ctx context.Context, u string, v interface{}) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Accept", "application/json")
+
+	return c.doJSON(r, v)
+}
+
+// doJSON decodes the response into v, also when the status is not OK, so an error body can be read.
+func (c *OIDCClient) doJSON(r *http.Request, v interface{}) error {
+	resp, err := c.httpClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(b, v)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return err
+}
+
+// IdentityUserSource is implemented by a UserSource that can look up a user by a linked account of an
+// OpenID Connect provider. With it the user that linked the account is found, also after the address
+// changed at the provider or in the application.
+type IdentityUserSource interface {
+	SelectByIdentity(ctx context.Context, provider, subject string) (*User, error)
+}
+
+// LoginWithOIDC logs in the user with the verified e-mail address of the claims, which are returned by
+// Exchange of the client of the provider. The user that linked the provider account is logged in, or
+// else the user with the address, to which the provider account is linked. A user is created when the
+// address is unknown. Like Login it can require the second factor.
+//
+// Linking confirms an unconfirmed user, whose password and second factor are removed: whoever
+// registered the address may not own it.
+func (u *UserRegistration) LoginWithOIDC(ctx context.Context, provider string, claims *OIDCClaims) (*Result, error) {
+	if !claims.EmailVerified || claims.Email == "" {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	res := new(Result)
+
+	key, err := u.emailNormalizer.Normalize(claims.Email)
+	if err != nil {
+		return res.add(newFieldError(FieldEmail, CodeInvalidEmail, ErrInvalidEmail)), nil
+	}
+
+	var user *User
+	if source, ok := u.userSource.(IdentityUserSource); ok {
+		user, err = source.SelectByIdentity(ctx, provider, claims.Subject)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if user == nil {
+		user, err = u.selectUser(ctx, claims.Email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if user != nil {
+		deleted, err := u.deletionDue(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+
+		if deleted {
+			user = nil
+		}
+	}
+
+	now := time.Now()
+	identity := LinkedIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    strings.TrimSpace(claims.Email),
+		LinkedAt: now,
+	}
+
+	if user == nil {
+		if u.inviteOnly {
+			return res.add(newFieldError(FieldEmail, CodeInvitationRequired, ErrInvitationRequired)), nil
+		}
+
+		err = u.checkEmailDomain(key)
+		if err != nil {
+			return res.add(emailDomainError(FieldEmail, err)), nil
+		}
+
+		// the user has no password, one can be set with Forgot and Reset
+		user = &User{
+			Email:           key,
+			DisplayEmail:    identity.Email,
+			CreatedAt:       now,
+			ConfirmedAt:     &now,
+			ApprovalPending: u.approvalRequired,
+			Identities:      []LinkedIdentity{identity},
+		}
+
+		err = u.insertUser(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+
+		if user.ApprovalPending {
+			return res.add(newFieldError(FieldEmail, CodeAwaitingApproval, ErrAwaitingApproval)), nil
+		}
+
+		res.User = user
+
+		return res, nil
+	}
+
+	linked := user.identity(provider)
+	if linked != nil && linked.Subject != claims.Subject {
+		return nil, ErrOIDCIdentityMismatch
+	}
+
+	if linked == nil {
+		user.Identities = append(user.Identities, identity)
+	} else {
+		linked.Email = identity.Email
+	}
+
+	// the unconfirmed user may have been registered by someone else than the owner of the address,
+	// who must not keep access with the password or second factor they set
+	if user.ConfirmedAt == nil {
+		user.Password = ""
+		user.PasswordHistory = nil
+		user.PasswordChangedAt = nil
+		user.TOTPSecret = ""
+		user.TOTPEnabledAt = nil
+		user.RecoveryCodes = nil
+		user.SessionVersion++
+	}
+
+	return u.loginVerifiedUser(ctx, user)
+}
@@ -0,0 +1,253 @@
+package user_registration_test
+
+import (
+	"context"
+	ur "github.com/caselongo/user-registration-go/user-registration"
+	"github.com/caselongo/user-registration-go/user-registration/oidctest"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testRedirectURL = "http://app.example/login/oidc/test/callback"
+
+func newTestOIDCClient(t *testing.T) (*ur.OIDCClient, *oidctest.Server) {
+	t.Helper()
+
+	server := oidctest.NewServer("client", "secret")
+	t.Cleanup(server.Close)
+
+	client, err := ur.NewOIDCClient(context.Background(), ur.OIDCProvider{
+		Name:         "test",
+		Issuer:       server.Issuer(),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  testRedirectURL,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, server
+}
+
+// authorize sends the browser to the provider and returns the request with the state and code it redirects back with.
+func authorize(t *testing.T, client *ur.OIDCClient) (ur.OIDCAuthRequest, string, string) {
+	t.Helper()
+
+	authURL, req, err := client.AuthCodeURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	browser := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := browser.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return req, location.Query().Get("state"), location.Query().Get("code")
+}
+
+// oidcLogin logs in the user of the provider and passes the claims to LoginWithOIDC.
+func oidcLogin(t *testing.T, u *ur.UserRegistration, client *ur.OIDCClient) *ur.Result {
+	t.Helper()
+
+	req, state, code := authorize(t, client)
+
+	claims, err := client.Exchange(context.Background(), req, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := u.LoginWithOIDC(context.Background(), client.Name(), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func TestLoginWithOIDCNewUser(t *testing.T) {
+	ctx := context.Background()
+	u, users, _ := ur.NewTestUserRegistration(t, nil)
+	client, server := newTestOIDCClient(t)
+
+	server.SetUser(oidctest.User{Subject: "1", Email: "Alice@Example.com", EmailVerified: true})
+
+	res := oidcLogin(t, u, client)
+	if !res.OK() || res.User.Email != "alice@example.com" {
+		t.Fatalf("login: %v %v", res.Err(), res.User)
+	}
+
+	user, _ := users.Select(ctx, "alice@example.com")
+	if user == nil || user.ConfirmedAt == nil || user.HasPassword() || len(user.Identities) != 1 || user.Identities[0].Subject != "1" {
+		t.Fatalf("created user %+v", user)
+	}
+
+	// the next login finds the same user
+	res = oidcLogin(t, u, client)
+	if !res.OK() || res.User.Email != "alice@example.com" {
+		t.Errorf("second login: %v", res.Err())
+	}
+
+	if count, _ := users.Count(ctx); count != 1 {
+		t.Errorf("%d users, want 1", count)
+	}
+
+	server.SetUser(oidctest.User{Subject: "2", Email: "bob@example.com"})
+
+	req, state, code := authorize(t, client)
+	claims, err := client.Exchange(ctx, req, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = u.LoginWithOIDC(ctx, client.Name(), claims)
+	if err != ur.ErrOIDCEmailNotVerified {
+		t.Errorf("unverified address: err = %v", err)
+	}
+}
+
+func TestLoginWithOIDCLinksExistingUser(t *testing.T) {
+	ctx := context.Background()
+	u, users, mail := ur.NewTestUserRegistration(t, nil)
+	client, server := newTestOIDCClient(t)
+
+	_, err := u.Register(ctx, "bob@example.com", ur.TestPassword, ur.TestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = u.Confirm(ctx, mail.Last("confirm")); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetUser(oidctest.User{Subject: "42", Email: "bob@example.com", EmailVerified: true})
+
+	res := oidcLogin(t, u, client)
+	if !res.OK() {
+		t.Fatalf("login: %v", res.Err())
+	}
+
+	user, _ := users.Select(ctx, "bob@example.com")
+	if len(user.Identities) != 1 || user.Identities[0].Subject != "42" {
+		t.Errorf("identities %+v", user.Identities)
+	}
+
+	// a confirmed user keeps its password
+	res, err = u.Login(ctx, "bob@example.com", ur.TestPassword)
+	if err != nil || !res.OK() {
+		t.Errorf("password login after linking: %v %v", err, res.Err())
+	}
+
+	// found by the linked account after the address changed at the provider
+	server.SetUser(oidctest.User{Subject: "42", Email: "robert@example.com", EmailVerified: true})
+
+	res = oidcLogin(t, u, client)
+	if !res.OK() || res.User.Email != "bob@example.com" {
+		t.Errorf("login with a changed address: %v %v", res.Err(), res.User)
+	}
+
+	// another account of the provider with the address is not linked
+	server.SetUser(oidctest.User{Subject: "43", Email: "bob@example.com", EmailVerified: true})
+
+	req, state, code := authorize(t, client)
+	claims, err := client.Exchange(ctx, req, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = u.LoginWithOIDC(ctx, client.Name(), claims)
+	if err != ur.ErrOIDCIdentityMismatch {
+		t.Errorf("other account: err = %v", err)
+	}
+}
+
+// An attacker registers the address of the victim, who never confirms it but later logs in with the provider.
+func TestLoginWithOIDCUnconfirmedTakeover(t *testing.T) {
+	ctx := context.Background()
+	u, users, _ := ur.NewTestUserRegistration(t, nil)
+	client, server := newTestOIDCClient(t)
+
+	res, err := u.Register(ctx, "victim@example.com", ur.TestPassword, ur.TestPassword)
+	if err != nil || !res.OK() {
+		t.Fatalf("register: %v %v", err, res.Err())
+	}
+
+	before, _ := users.Select(ctx, "victim@example.com")
+
+	server.SetUser(oidctest.User{Subject: "7", Email: "victim@example.com", EmailVerified: true})
+
+	res = oidcLogin(t, u, client)
+	if !res.OK() {
+		t.Fatalf("login: %v", res.Err())
+	}
+
+	user, _ := users.Select(ctx, "victim@example.com")
+	if user.ConfirmedAt == nil || user.HasPassword() || len(user.PasswordHistory) != 0 {
+		t.Errorf("confirmed %v, password kept %v", user.ConfirmedAt, user.HasPassword())
+	}
+
+	if user.SessionVersion == before.SessionVersion {
+		t.Error("sessions of the attacker remain valid")
+	}
+
+	res, err = u.Login(ctx, "victim@example.com", ur.TestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OK() {
+		t.Error("the attacker can log in with the password")
+	}
+}
+
+func TestOIDCExchangeInvalid(t *testing.T) {
+	ctx := context.Background()
+	client, server := newTestOIDCClient(t)
+
+	server.SetUser(oidctest.User{Subject: "1", Email: "alice@example.com", EmailVerified: true})
+
+	req, state, code := authorize(t, client)
+	if _, err := client.Exchange(ctx, req, "other state", code); err == nil {
+		t.Error("exchanged with another state")
+	}
+
+	req, state, code = authorize(t, client)
+	req.Nonce = "other nonce"
+	if _, err := client.Exchange(ctx, req, state, code); err == nil {
+		t.Error("ID token of another login attempt accepted")
+	}
+
+	req, state, code = authorize(t, client)
+	req.CreatedAt = time.Now().Add(-time.Hour)
+	if _, err := client.Exchange(ctx, req, state, code); err == nil {
+		t.Error("expired login attempt exchanged")
+	}
+
+	req, state, code = authorize(t, client)
+	if _, err := client.Exchange(ctx, req, state, code); err != nil {
+		t.Fatal(err)
+	}
+
+	// a code is redeemed once
+	if _, err := client.Exchange(ctx, req, state, code); err == nil {
+		t.Error("code redeemed twice")
+	}
+
+	req, state, _ = authorize(t, client)
+	if _, err := client.Exchange(ctx, req, state, "unknown"); err == nil {
+		t.Error("unknown code redeemed")
+	}
+}
@@ -0,0 +1,61 @@
+package user_registration
+
+import (
+	"context"
+	"fmt"
+)
+
+// ChangePassword changes the password of a logged in user, after checking the current password.
+// All other sessions of the user become invalid, the returned User carries the new session version.
+func (u *UserRegistration) ChangePassword(ctx context.Context, email, currentPassword, password, confirmPassword string) (*Result, error) {
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	ok, _, err := verifyPasswordHash(u.passwordHasher, currentPassword, user.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return new(Result).add(newFieldError(FieldCurrentPassword, CodeInvalidCredentials, ErrInvalidCredentials)), nil
+	}
+
+	res, err := u.checkNewPassword(ctx, user, email, password, confirmPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	if !res.OK() {
+		return res, nil
+	}
+
+	hashed, err := u.passwordHasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	u.setPassword(user, hashed)
+	user.SessionVersion++
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.HasMailSender() {
+		err = u.mailSender.PasswordChanged(ctx, user.Address())
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	res.User = user
+
+	return res, nil
+}
@@ -0,0 +1,36 @@
+package user_registration
+
+import "time"
+
+// passwordExpiresAt returns when the password of the user expires, the zero time when it never does
+// or the user has no password to change.
+func (u *UserRegistration) passwordExpiresAt(user *User) time.Time {
+	if u.passwordRequirements.MaxPasswordAge == 0 || !user.HasPassword() {
+		return time.Time{}
+	}
+
+	// users of earlier versions have no PasswordChangedAt
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+
+	return changedAt.Add(u.passwordRequirements.MaxPasswordAge)
+}
+
+func (u *UserRegistration) passwordExpired(user *User) bool {
+	expiresAt := u.passwordExpiresAt(user)
+
+	return !expiresAt.IsZero() && !time.Now().Before(expiresAt)
+}
+
+// PasswordExpiry returns when the password of the user expires, if that is within the
+// PasswordExpiryWarning period, so the user can be warned to change it in time.
+func (u *UserRegistration) PasswordExpiry(user User) (time.Time, bool) {
+	expiresAt := u.passwordExpiresAt(&user)
+	if expiresAt.IsZero() || u.passwordRequirements.PasswordExpiryWarning == 0 {
+		return time.Time{}, false
+	}
+
+	return expiresAt, time.Until(expiresAt) <= u.passwordRequirements.PasswordExpiryWarning
+}
@@ -0,0 +1,67 @@
+package user_registration
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPasswordExpiry(t *testing.T) {
+	ctx := context.Background()
+	u, users, mail := newTestUserRegistration(t, &NewUserRegistrationConfig{
+		PasswordRequirements: &PasswordRequirements{
+			MaxPasswordAge:        90 * 24 * time.Hour,
+			PasswordExpiryWarning: 14 * 24 * time.Hour,
+		},
+	})
+
+	user := registerConfirmed(t, u, mail, "bob@example.com")
+
+	if _, warn := u.PasswordExpiry(*user); warn {
+		t.Error("new password expires soon")
+	}
+
+	changedAt := time.Now().Add(-80 * 24 * time.Hour)
+	user.PasswordChangedAt = &changedAt
+
+	if expiresAt, warn := u.PasswordExpiry(*user); !warn || !expiresAt.Equal(changedAt.Add(90*24*time.Hour)) {
+		t.Errorf("password changed 80 days ago: expires at %v, warn %v", expiresAt, warn)
+	}
+
+	changedAt = time.Now().Add(-100 * 24 * time.Hour)
+	user.PasswordChangedAt = &changedAt
+
+	err := users.Update(ctx, *user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := u.Login(ctx, "bob@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.PasswordExpired {
+		t.Error("expired password not reported")
+	}
+}
+
+func TestPasswordExpiryWithoutPassword(t *testing.T) {
+	u, _, _ := newTestUserRegistration(t, &NewUserRegistrationConfig{
+		PasswordRequirements: &PasswordRequirements{
+			MaxPasswordAge:        90 * 24 * time.Hour,
+			PasswordExpiryWarning: 14 * 24 * time.Hour,
+		},
+	})
+
+	// as created by a sign-in link or an OpenID Connect login long ago
+	createdAt := time.Now().Add(-365 * 24 * time.Hour)
+	user := User{Email: "alice@example.com", CreatedAt: createdAt, ConfirmedAt: &createdAt}
+
+	if u.passwordExpired(&user) {
+		t.Error("missing password expired")
+	}
+
+	if _, warn := u.PasswordExpiry(user); warn {
+		t.Error("warned about a missing password")
+	}
+}
@@ -0,0 +1,390 @@
+package user_registration
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+	"strings"
+)
+
+const (
+	maxBytesPerHash int = 72
+
+	defaultBcryptCost      int    = 14
+	defaultArgon2idTime    uint32 = 3
+	defaultArgon2idMemory  uint32 = 64 * 1024
+	defaultArgon2idThreads uint8  = 2
+	defaultScryptLogN      uint8  = 15
+	defaultScryptR         int    = 8
+	defaultScryptP         int    = 1
+	defaultSaltLength      int    = 16
+	defaultKeyLength       int    = 32
+
+	// bounds for parameters read from stored hashes, so a corrupt hash cannot crash or stall a login.
+	// Besides each parameter, the memory and the work they make up together are bounded.
+	maxArgon2idTime    uint32 = 16
+	maxArgon2idMemory  uint32 = 1024 * 1024     // KiB, 1 GiB
+	maxArgon2idWork    uint64 = 4 * 1024 * 1024 // time × memory in KiB
+	maxArgon2idThreads uint8  = 64
+	maxScryptLogN      uint8  = 30
+	maxScryptR         int    = 64
+	maxScryptP         int    = 64
+	maxScryptMemory    uint64 = 1 << 30 // bytes, 128 × r × N
+	maxScryptWork      uint64 = 4 << 30 // 128 × r × N × p
+)
+
+var errInvalidHash = errors.New("invalid password hash")
+
+// PasswordHasher hashes passwords into self-describing strings.
+// NeedsRehash reports whether a stored hash is not in the hasher's current algorithm and parameters,
+// in which case it is replaced on the next successful login.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// BcryptHasher produces standard $2a$ bcrypt hashes. Bcrypt cannot hash passwords longer than 72 bytes.
+type BcryptHasher struct {
+	Cost int // default 14
+}
+
+func (h *BcryptHasher) cost() int {
+	if h.Cost == 0 {
+		return defaultBcryptCost
+	}
+	return h.Cost
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.cost())
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (h *BcryptHasher) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	if !isBcryptHash(hash) || isLegacyHash(hash) {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+
+	return cost != h.cost()
+}
+
+// Argon2idHasher produces $argon2id$v=19$m=...,t=...,p=...$salt$hash strings.
+type Argon2idHasher struct {
+	Time    uint32 // default 3
+	Memory  uint32 // in KiB, default 65536
+	Threads uint8  // default 2
+}
+
+type argon2idParams struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+func (h *Argon2idHasher) params() argon2idParams {
+	p := argon2idParams{
+		time:    h.Time,
+		memory:  h.Memory,
+		threads: h.Threads,
+	}
+
+	if p.time == 0 {
+		p.time = defaultArgon2idTime
+	}
+	if p.memory == 0 {
+		p.memory = defaultArgon2idMemory
+	}
+	if p.threads == 0 {
+		p.threads = defaultArgon2idThreads
+	}
+
+	return p
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	p := h.params()
+
+	salt, err := getSalt()
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(defaultKeyLength))
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.time, p.threads, encodeHashPart(salt), encodeHashPart(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(password, hash string) (bool, error) {
+	p, salt, key, err := parseArgon2idHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	p, _, key, err := parseArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+
+	return p != h.params() || len(key) != defaultKeyLength
+}
+
+func parseArgon2idHash(hash string) (argon2idParams, []byte, []byte, error) {
+	var p argon2idParams
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, errInvalidHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return p, nil, nil, errInvalidHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads)
+	if err != nil ||
+		p.time < 1 || p.time > maxArgon2idTime ||
+		p.threads < 1 || p.threads > maxArgon2idThreads ||
+		p.memory < 8*uint32(p.threads) || p.memory > maxArgon2idMemory ||
+		uint64(p.time)*uint64(p.memory) > maxArgon2idWork {
+		return p, nil, nil, errInvalidHash
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[4], parts[5])
+	if err != nil {
+		return p, nil, nil, err
+	}
+
+	return p, salt, key, nil
+}
+
+// ScryptHasher produces $scrypt$ln=...,r=...,p=...$salt$hash strings, where ln is log2(N).
+type ScryptHasher struct {
+	LogN uint8 // default 15
+	R    int   // default 8
+	P    int   // default 1
+}
+
+type scryptParams struct {
+	logN uint8
+	r    int
+	p    int
+}
+
+func (h *ScryptHasher) params() scryptParams {
+	p := scryptParams{
+		logN: h.LogN,
+		r:    h.R,
+		p:    h.P,
+	}
+
+	if p.logN == 0 {
+		p.logN = defaultScryptLogN
+	}
+	if p.r == 0 {
+		p.r = defaultScryptR
+	}
+	if p.p == 0 {
+		p.p = defaultScryptP
+	}
+
+	return p
+}
+
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	p := h.params()
+
+	salt, err := getSalt()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, 1<<p.logN, p.r, p.p, defaultKeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", p.logN, p.r, p.p, encodeHashPart(salt), encodeHashPart(key)), nil
+}
+
+func (h *ScryptHasher) Verify(password, hash string) (bool, error) {
+	p, salt, key, err := parseScryptHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	other, err := scrypt.Key([]byte(password), salt, 1<<p.logN, p.r, p.p, len(key))
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h *ScryptHasher) NeedsRehash(hash string) bool {
+	p, _, key, err := parseScryptHash(hash)
+	if err != nil {
+		return true
+	}
+
+	return p != h.params() || len(key) != defaultKeyLength
+}
+
+func parseScryptHash(hash string) (scryptParams, []byte, []byte, error) {
+	var p scryptParams
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[0] != "" || parts[1] != "scrypt" {
+		return p, nil, nil, errInvalidHash
+	}
+
+	_, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &p.logN, &p.r, &p.p)
+	if err != nil || p.logN == 0 || p.logN > maxScryptLogN || p.r < 1 || p.r > maxScryptR || p.p < 1 || p.p > maxScryptP {
+		return p, nil, nil, errInvalidHash
+	}
+
+	// the limits above keep these products well within 64 bits
+	memory := 128 * uint64(p.r) << p.logN
+	if memory > maxScryptMemory || memory*uint64(p.p) > maxScryptWork {
+		return p, nil, nil, errInvalidHash
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[3], parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+
+	return p, salt, key, nil
+}
+
+// verifyPasswordHash checks a password against a hash in any supported format, so hashes made
+// by a previously configured hasher keep working. rehash is true when the hash should be upgraded.
+func verifyPasswordHash(hasher PasswordHasher, password, hash string) (ok bool, rehash bool, err error) {
+	// users created by logging in with an OpenID Connect provider have no password
+	if hash == "" {
+		return false, false, nil
+	}
+
+	// checked first, a bcrypt hasher would only compare the first chunk of a legacy hash
+	if isLegacyHash(hash) {
+		ok = verifyLegacyHash(password, hash)
+		return ok, ok, nil
+	}
+
+	if !hasher.NeedsRehash(hash) {
+		ok, err = hasher.Verify(password, hash)
+		return ok, false, err
+	}
+
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		ok, err = new(Argon2idHasher).Verify(password, hash)
+	case strings.HasPrefix(hash, "$scrypt$"):
+		ok, err = new(ScryptHasher).Verify(password, hash)
+	case isBcryptHash(hash):
+		ok, err = new(BcryptHasher).Verify(password, hash)
+	default:
+		ok, err = hasher.Verify(password, hash)
+	}
+
+	return ok, ok, err
+}
+
+// verifyLegacyHash checks the format of earlier versions: the password split into chunks
+// of 72 bytes, each hashed with bcrypt, joined by spaces.
+func verifyLegacyHash(password, hash string) bool {
+	b := []byte(password)
+
+	for _, h := range strings.Split(hash, " ") {
+		if len(b) == 0 {
+			return false
+		}
+
+		b1 := b
+		if len(b1) > maxBytesPerHash {
+			b1 = b1[:maxBytesPerHash]
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(h), b1)
+		if err != nil {
+			return false
+		}
+		if len(b) > maxBytesPerHash {
+			b = b[maxBytesPerHash:]
+		} else {
+			b = []byte{}
+		}
+	}
+
+	return len(b) == 0
+}
+
+// isLegacyHash reports whether the hash is in the chunked bcrypt format of earlier versions.
+func isLegacyHash(hash string) bool {
+	return strings.Contains(hash, " ")
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func getSalt() ([]byte, error) {
+	salt := make([]byte, defaultSaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return salt, nil
+}
+
+func encodeHashPart(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+func decodeSaltAndKey(s, k string) ([]byte, []byte, error) {
+	salt, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, nil, errInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(k)
+	if err != nil || len(key) == 0 {
+		return nil, nil, errInvalidHash
+	}
+
+	return salt, key, nil
+}
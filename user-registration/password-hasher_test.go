@@ -0,0 +1,150 @@
+package user_registration
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// legacyHash builds a hash in the format of earlier versions: bcrypt hashes of 72 byte chunks, joined by spaces.
+func legacyHash(t *testing.T, password string, cost int) string {
+	t.Helper()
+
+	var hashes []string
+	for b := []byte(password); len(b) > 0; {
+		chunk := b
+		if len(chunk) > maxBytesPerHash {
+			chunk = chunk[:maxBytesPerHash]
+		}
+		b = b[len(chunk):]
+
+		h, err := bcrypt.GenerateFromPassword(chunk, cost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, string(h))
+	}
+
+	return strings.Join(hashes, " ")
+}
+
+func TestVerifyPasswordHashLegacy(t *testing.T) {
+	hasher := &BcryptHasher{Cost: bcrypt.MinCost}
+	password := strings.Repeat("a", maxBytesPerHash) + "correct suffix"
+	hash := legacyHash(t, password, bcrypt.MinCost)
+
+	if !hasher.NeedsRehash(hash) {
+		t.Error("legacy hash with the configured cost does not need a rehash")
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		ok       bool
+	}{
+		{"correct", password, true},
+		{"wrong suffix", strings.Repeat("a", maxBytesPerHash) + "wrong suffix", false},
+		{"first chunk only", strings.Repeat("a", maxBytesPerHash), false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := verifyPasswordHash(hasher, tt.password, hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ok != tt.ok {
+				t.Errorf("ok = %v, want %v", ok, tt.ok)
+			}
+
+			if rehash != tt.ok {
+				t.Errorf("rehash = %v, want %v", rehash, tt.ok)
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordHashUpgrade(t *testing.T) {
+	old, err := (&ScryptHasher{LogN: 4}).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasher := &BcryptHasher{Cost: bcrypt.MinCost}
+
+	ok, rehash, err := verifyPasswordHash(hasher, "secret", old)
+	if err != nil || !ok || !rehash {
+		t.Errorf("hash of another hasher: ok = %v, rehash = %v, err = %v", ok, rehash, err)
+	}
+
+	current, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, rehash, err = verifyPasswordHash(hasher, "secret", current)
+	if err != nil || !ok || rehash {
+		t.Errorf("current hash: ok = %v, rehash = %v, err = %v", ok, rehash, err)
+	}
+
+	ok, _, _ = verifyPasswordHash(hasher, "", "")
+	if ok {
+		t.Error("empty hash verified")
+	}
+}
+
+func TestParseHashBounds(t *testing.T) {
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5"
+
+	argon2id := []string{
+		"$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=0,p=2$" + salt + "$" + key,
+		"$argon2id$v=19$m=8,t=3,p=2$" + salt + "$" + key,
+		"$argon2id$v=19$m=4294967295,t=3,p=2$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=4294967295,p=2$" + salt + "$" + key,
+		"$argon2id$v=19$m=2097152,t=1,p=2$" + salt + "$" + key,
+		"$argon2id$v=19$m=65536,t=17,p=2$" + salt + "$" + key,
+		// each parameter within its bound, together too costly
+		"$argon2id$v=19$m=1048576,t=16,p=4$" + salt + "$" + key,
+		"$argon2id$v=19$m=524288,t=9,p=4$" + salt + "$" + key,
+	}
+
+	for _, hash := range argon2id {
+		_, err := new(Argon2idHasher).Verify("secret", hash)
+		if err != errInvalidHash {
+			t.Errorf("%s: err = %v, want errInvalidHash", hash, err)
+		}
+	}
+
+	scrypt := []string{
+		"$scrypt$ln=4,r=8,p=0$" + salt + "$" + key,
+		"$scrypt$ln=4,r=0,p=1$" + salt + "$" + key,
+		"$scrypt$ln=31,r=8,p=1$" + salt + "$" + key,
+		"$scrypt$ln=4,r=65,p=1$" + salt + "$" + key,
+		"$scrypt$ln=4,r=8,p=65$" + salt + "$" + key,
+		// each parameter within its bound, together too costly
+		"$scrypt$ln=30,r=64,p=1$" + salt + "$" + key,
+		"$scrypt$ln=24,r=8,p=1$" + salt + "$" + key,
+		"$scrypt$ln=20,r=8,p=8$" + salt + "$" + key,
+	}
+
+	for _, hash := range scrypt {
+		_, err := new(ScryptHasher).Verify("secret", hash)
+		if err != errInvalidHash {
+			t.Errorf("%s: err = %v, want errInvalidHash", hash, err)
+		}
+	}
+
+	valid, err := (&Argon2idHasher{Time: 1, Memory: 64, Threads: 1}).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := new(Argon2idHasher).Verify("secret", valid)
+	if err != nil || !ok {
+		t.Errorf("valid hash: ok = %v, err = %v", ok, err)
+	}
+}
@@ -0,0 +1,48 @@
+package user_registration
+
+import "time"
+
+// passwordReused reports whether the password is the current password of the user or one of the
+// previous passwords kept in the history.
+func (u *UserRegistration) passwordReused(user *User, password string) (bool, error) {
+	if u.passwordRequirements.HistorySize == 0 {
+		return false, nil
+	}
+
+	hashes := append([]string{user.Password}, user.PasswordHistory...)
+	if len(hashes) > int(u.passwordRequirements.HistorySize) {
+		hashes = hashes[:u.passwordRequirements.HistorySize]
+	}
+
+	for _, hash := range hashes {
+		ok, _, err := verifyPasswordHash(u.passwordHasher, password, hash)
+		if err != nil {
+			return false, err
+		}
+
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// setPassword replaces the password hash of the user, keeping the previous one in the history.
+func (u *UserRegistration) setPassword(user *User, hashed string) {
+	// the current password is part of the history size
+	size := int(u.passwordRequirements.HistorySize) - 1
+
+	var history []string
+	if size > 0 {
+		history = append([]string{user.Password}, user.PasswordHistory...)
+		if len(history) > size {
+			history = history[:size]
+		}
+	}
+
+	now := time.Now()
+	user.Password = hashed
+	user.PasswordHistory = history
+	user.PasswordChangedAt = &now
+}
@@ -0,0 +1,231 @@
+package user_registration
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// PasswordRule is a requirement for passwords. Check reports whether the password of the user
+// with the email address fulfills the rule, Describe returns the requirement as shown to users,
+// e.g. "at least 8 characters".
+type PasswordRule interface {
+	Check(password, email string) bool
+	Describe() string
+}
+
+// passwordFeedbacker is implemented by rules that can suggest how to fulfill them. CheckFeedback
+// checks like Check and returns the suggestions along, when working them out takes the same effort.
+type passwordFeedbacker interface {
+	CheckFeedback(password, email string) (bool, []string)
+}
+
+type MinLengthRule struct {
+	Length uint
+}
+
+func (r MinLengthRule) Check(password, _ string) bool {
+	return uint(len(password)) >= r.Length
+}
+
+func (r MinLengthRule) Describe() string {
+	return fmt.Sprintf("at least %v characters", r.Length)
+}
+
+type MaxLengthRule struct {
+	Length uint
+}
+
+func (r MaxLengthRule) Check(password, _ string) bool {
+	return uint(len(password)) <= r.Length
+}
+
+func (r MaxLengthRule) Describe() string {
+	return fmt.Sprintf("at most %v characters", r.Length)
+}
+
+type NoSpacesRule struct{}
+
+func (r NoSpacesRule) Check(password, _ string) bool {
+	return !strings.Contains(password, " ")
+}
+
+func (r NoSpacesRule) Describe() string {
+	return "no spaces"
+}
+
+type CharacterClass int
+
+const (
+	LowerCase CharacterClass = iota
+	UpperCase
+	Number
+	Special
+)
+
+// classify returns the class of a character, letters that are not upper case count as lower case.
+func classify(c rune) (CharacterClass, bool) {
+	switch {
+	case unicode.IsNumber(c):
+		return Number, true
+	case unicode.IsUpper(c):
+		return UpperCase, true
+	case unicode.IsPunct(c) || unicode.IsSymbol(c):
+		return Special, true
+	case unicode.IsLetter(c):
+		return LowerCase, true
+	default:
+		return 0, false
+	}
+}
+
+// CharacterClassRule requires a minimum number of characters of a class.
+type CharacterClassRule struct {
+	Class CharacterClass
+	Min   uint
+}
+
+func (r CharacterClassRule) Check(password, _ string) bool {
+	var count uint
+	for _, c := range password {
+		if class, ok := classify(c); ok && class == r.Class {
+			count++
+		}
+	}
+
+	return count >= r.Min
+}
+
+func (r CharacterClassRule) Describe() string {
+	switch r.Class {
+	case LowerCase:
+		return fmt.Sprintf("at least %v lower case letter(s)", r.Min)
+	case UpperCase:
+		return fmt.Sprintf("at least %v upper case letter(s)", r.Min)
+	case Number:
+		return fmt.Sprintf("at least %v number(s)", r.Min)
+	default:
+		return fmt.Sprintf("at least %v special character(s)", r.Min)
+	}
+}
+
+// StrengthRule requires a minimum score (0-4) of EstimatePasswordStrength, with the email address as user input.
+type StrengthRule struct {
+	MinScore uint
+}
+
+func (r StrengthRule) Check(password, email string) bool {
+	return EstimatePasswordStrength(password, email).Score >= r.MinScore
+}
+
+func (r StrengthRule) Describe() string {
+	return fmt.Sprintf("a strength score of at least %v out of 4", r.MinScore)
+}
+
+func (r StrengthRule) CheckFeedback(password, email string) (bool, []string) {
+	s := EstimatePasswordStrength(password, email)
+
+	return s.Score >= r.MinScore, s.Feedback
+}
+
+// NoEmailRule forbids passwords containing the local part of the email address.
+type NoEmailRule struct{}
+
+func (r NoEmailRule) Check(password, email string) bool {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+
+	return local == "" || !strings.Contains(strings.ToLower(password), local)
+}
+
+func (r NoEmailRule) Describe() string {
+	return "not containing your e-mail address"
+}
+
+// MaxRepeatRule limits the number of times a character may be repeated in a row.
+type MaxRepeatRule struct {
+	Max uint
+}
+
+func (r MaxRepeatRule) Check(password, _ string) bool {
+	var repeats uint
+	var last rune = -1
+
+	for _, c := range password {
+		if c == last {
+			repeats++
+		} else {
+			repeats = 1
+			last = c
+		}
+
+		if repeats > r.Max {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r MaxRepeatRule) Describe() string {
+	return fmt.Sprintf("no character more than %v times in a row", r.Max)
+}
+
+// DenyListRule forbids passwords that equal one of the words, ignoring case.
+type DenyListRule struct {
+	Words []string
+}
+
+func (r DenyListRule) Check(password, _ string) bool {
+	for _, w := range r.Words {
+		if strings.EqualFold(password, w) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r DenyListRule) Describe() string {
+	return "not a forbidden password"
+}
+
+// passwordRules returns the built-in rules for the fields of the requirements, followed by the custom rules.
+func (p *PasswordRequirements) passwordRules() []PasswordRule {
+	minLength := defaultPasswordMinLength
+	if p.MinLength != nil {
+		minLength = *p.MinLength
+	}
+
+	maxLength := defaultPasswordMaxLength
+	if p.MaxLength != nil {
+		maxLength = *p.MaxLength
+	}
+
+	rules := []PasswordRule{
+		MinLengthRule{Length: minLength},
+		MaxLengthRule{Length: maxLength},
+		NoSpacesRule{},
+	}
+
+	classes := []struct {
+		class CharacterClass
+		min   *uint
+	}{
+		{LowerCase, p.MinLowers},
+		{UpperCase, p.MinUppers},
+		{Number, p.MinNumbers},
+		{Special, p.MinSpecials},
+	}
+
+	for _, c := range classes {
+		if c.min != nil {
+			rules = append(rules, CharacterClassRule{Class: c.class, Min: *c.min})
+		}
+	}
+
+	if p.MinStrengthScore != nil {
+		rules = append(rules, StrengthRule{MinScore: *p.MinStrengthScore})
+	}
+
+	return append(rules, p.Rules...)
+}
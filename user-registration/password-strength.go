@@ -0,0 +1,901 @@
+package user_registration
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The strength estimation follows the ideas of zxcvbn: the password is split into the sequence
+// of guessable patterns (dictionary words, keyboard patterns, sequences, repeats and dates) that
+// takes the least guesses to crack, the parts not matching any pattern are guessed by brute force.
+
+const (
+	maxStrengthLength            = 100 // only the start of longer passwords is estimated
+	bruteforceCardinality        = 10
+	minSubmatchGuessesSingleChar = 10
+	minSubmatchGuessesMultiChar  = 50
+	minGuessesBeforeGrowing      = 10000
+	minYearSpace                 = 20
+	keyboardStartingPositions    = 47
+	keyboardAverageDegree        = 4
+)
+
+const (
+	patternDictionary = "dictionary"
+	patternUserInput  = "user-input"
+	patternSpatial    = "spatial"
+	patternSequence   = "sequence"
+	patternRepeat     = "repeat"
+	patternDate       = "date"
+	patternBruteforce = "bruteforce"
+)
+
+// PasswordStrength is the estimated strength of a password. Score runs from 0 (too guessable)
+// to 4 (very unguessable), Feedback holds suggestions to make a weak password stronger.
+type PasswordStrength struct {
+	Score    uint
+	Guesses  float64
+	Feedback []string
+}
+
+type strengthMatch struct {
+	pattern  string
+	i, j     int // first and last rune of the match
+	guesses  float64
+	rank     int
+	common   bool // the dictionary match is a common password
+	reversed bool
+	l33t     bool
+	upper    bool
+}
+
+var l33tTables = []map[rune]rune{
+	{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i', '|': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+	{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'l', '!': 'i', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+}
+
+// rankedDictionary splits a word list on white space, the rank of a word is its position in the list.
+func rankedDictionary(words string) map[string]int {
+	d := make(map[string]int)
+	for i, w := range strings.Fields(words) {
+		if _, ok := d[w]; !ok {
+			d[w] = i + 1
+		}
+	}
+
+	return d
+}
+
+// userInputDictionary turns inputs like the email address into a dictionary of lower case words,
+// split on punctuation.
+func userInputDictionary(inputs []string) map[string]int {
+	var words []string
+	for _, input := range inputs {
+		input = strings.ToLower(input)
+		local, _, _ := strings.Cut(input, "@")
+		words = append(words, input, local)
+		words = append(words, strings.FieldsFunc(input, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})...)
+	}
+
+	d := make(map[string]int)
+	for _, w := range words {
+		if len([]rune(w)) >= 3 {
+			if _, ok := d[w]; !ok {
+				d[w] = len(d) + 1
+			}
+		}
+	}
+
+	return d
+}
+
+// stripUserInputs removes the words of the user inputs from the password wherever they occur, in any
+// case and with l33t substitutions, longest words first. It returns the rest of the password, the
+// guesses needed to put the removed words back and the removed words as matches.
+func stripUserInputs(runes []rune, userInputs map[string]int) ([]rune, float64, []strengthMatch) {
+	words := make([]string, 0, len(userInputs))
+	for w := range userInputs {
+		words = append(words, w)
+	}
+	sort.Slice(words, func(a, b int) bool {
+		if len(words[a]) != len(words[b]) {
+			return len(words[a]) > len(words[b])
+		}
+		return words[a] < words[b]
+	})
+
+	guesses := 1.0
+	var removed []strengthMatch
+
+	for {
+		i, word, l33t := findUserInput(runes, words)
+		if i < 0 {
+			return runes, guesses, removed
+		}
+
+		token := runes[i : i+len(word)]
+		m := strengthMatch{
+			pattern: patternUserInput,
+			j:       len(word) - 1,
+			rank:    userInputs[string(word)],
+			l33t:    l33t,
+		}
+
+		upper := uppercaseVariations(token)
+		m.upper = upper > 1
+		m.guesses = float64(m.rank) * upper
+		if l33t {
+			m.guesses *= l33tVariations(token, word)
+		}
+
+		runes = append(append([]rune(nil), runes[:i]...), runes[i+len(word):]...)
+		removed = append(removed, m)
+
+		// the word could have been put anywhere in the rest
+		guesses *= m.guesses * float64(len(runes)+1)
+	}
+}
+
+// findUserInput returns the position of the first of the words found in the password, or -1.
+func findUserInput(runes []rune, words []string) (int, []rune, bool) {
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		return -1, nil, false
+	}
+
+	variants := l33tVariants(lower)
+
+	for _, w := range words {
+		word := []rune(w)
+		for v, variant := range variants {
+			if i := indexRunes(variant, word); i >= 0 {
+				return i, word, v > 0 && string(lower[i:i+len(word)]) != w
+			}
+		}
+	}
+
+	return -1, nil, false
+}
+
+func indexRunes(runes, sub []rune) int {
+	for i := 0; i+len(sub) <= len(runes); i++ {
+		if string(runes[i:i+len(sub)]) == string(sub) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// l33tVariants returns the lower case password followed by the password with the substitutions of each l33t table.
+func l33tVariants(lower []rune) [][]rune {
+	variants := [][]rune{lower}
+	for _, table := range l33tTables {
+		subbed := make([]rune, len(lower))
+		for k, r := range lower {
+			if s, ok := table[r]; ok {
+				subbed[k] = s
+			} else {
+				subbed[k] = r
+			}
+		}
+		variants = append(variants, subbed)
+	}
+
+	return variants
+}
+
+// EstimatePasswordStrength estimates how hard the password is to guess. Pass information about
+// the user, like the email address, as userInputs: passwords based on these are weak.
+func EstimatePasswordStrength(password string, userInputs ...string) PasswordStrength {
+	runes := []rune(password)
+	if len(runes) > maxStrengthLength {
+		runes = runes[:maxStrengthLength]
+	}
+
+	dictionary := userInputDictionary(userInputs)
+	guesses, sequence := mostGuessableSequence(runes, dictionary)
+	feedbackRunes := runes
+
+	// a password built around the user inputs is hardly stronger than the rest of it
+	if rest, inputGuesses, removed := stripUserInputs(runes, dictionary); len(removed) > 0 {
+		restGuesses, restSequence := mostGuessableSequence(rest, dictionary)
+		if restGuesses*inputGuesses < guesses {
+			guesses = restGuesses * inputGuesses
+			sequence = append(removed, restSequence...)
+			feedbackRunes = rest
+		}
+	}
+
+	s := PasswordStrength{
+		Score:   guessesToScore(guesses),
+		Guesses: guesses,
+	}
+
+	if s.Score < 4 {
+		s.Feedback = strengthFeedback(feedbackRunes, sequence)
+	}
+
+	return s
+}
+
+func guessesToScore(guesses float64) uint {
+	const delta = 5
+
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// mostGuessableSequence finds the sequence of non-overlapping matches, filled up with brute force,
+// that needs the least guesses.
+func mostGuessableSequence(runes []rune, userInputs map[string]int) (float64, []strengthMatch) {
+	n := len(runes)
+	if n == 0 {
+		return 1, nil
+	}
+
+	matches := omnimatch(runes, userInputs)
+
+	// best[k][l] is the least product of guesses covering the first k runes with l matches
+	type step struct {
+		product float64
+		match   *strengthMatch
+		prevL   int
+	}
+	best := make([][]step, n+1)
+	for k := range best {
+		best[k] = make([]step, n+1)
+		for l := range best[k] {
+			best[k][l].product = math.Inf(1)
+		}
+	}
+	best[0][0].product = 1
+
+	byEnd := make([][]strengthMatch, n)
+	for _, m := range matches {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+
+	for j := 0; j < n; j++ {
+		candidates := byEnd[j]
+		for i := 0; i <= j; i++ {
+			candidates = append(candidates, strengthMatch{
+				pattern: patternBruteforce,
+				i:       i,
+				j:       j,
+				guesses: math.Max(math.Pow(bruteforceCardinality, float64(j-i+1)), minSubmatchGuesses(j-i+1)),
+			})
+		}
+
+		for c := range candidates {
+			m := candidates[c]
+			for l := 0; l <= m.i; l++ {
+				prev := best[m.i][l]
+				if math.IsInf(prev.product, 1) {
+					continue
+				}
+
+				// two brute force matches in a row are one longer brute force match
+				if m.pattern == patternBruteforce && prev.match != nil && prev.match.pattern == patternBruteforce {
+					continue
+				}
+
+				product := prev.product * m.guesses
+				if product < best[j+1][l+1].product {
+					best[j+1][l+1] = step{product: product, match: &m, prevL: l}
+				}
+			}
+		}
+	}
+
+	bestL := 0
+	bestGuesses := math.Inf(1)
+	for l := 1; l <= n; l++ {
+		if math.IsInf(best[n][l].product, 1) {
+			continue
+		}
+
+		g := factorial(l)*best[n][l].product + math.Pow(minGuessesBeforeGrowing, float64(l-1))
+		if g < bestGuesses {
+			bestGuesses = g
+			bestL = l
+		}
+	}
+
+	var sequence []strengthMatch
+	for k, l := n, bestL; k > 0; {
+		s := best[k][l]
+		sequence = append([]strengthMatch{*s.match}, sequence...)
+		k, l = s.match.i, s.prevL
+	}
+
+	return bestGuesses, sequence
+}
+
+func minSubmatchGuesses(length int) float64 {
+	if length == 1 {
+		return minSubmatchGuessesSingleChar
+	}
+
+	return minSubmatchGuessesMultiChar
+}
+
+func factorial(n int) float64 {
+	f := 1.0
+	for i := 2; i <= n; i++ {
+		f *= float64(i)
+	}
+
+	return f
+}
+
+func omnimatch(runes []rune, userInputs map[string]int) []strengthMatch {
+	matches := dictionaryMatches(runes, commonPasswords, patternDictionary)
+	for k := range matches {
+		matches[k].common = true
+	}
+
+	matches = append(matches, dictionaryMatches(runes, commonWords, patternDictionary)...)
+	matches = append(matches, dictionaryMatches(runes, userInputs, patternUserInput)...)
+	matches = append(matches, spatialMatches(runes)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes, userInputs)...)
+	matches = append(matches, dateMatches(runes)...)
+
+	for k := range matches {
+		matches[k].guesses = math.Max(matches[k].guesses, minSubmatchGuesses(matches[k].j-matches[k].i+1))
+	}
+
+	return matches
+}
+
+// dictionaryMatches finds the words of the dictionary in the password, also reversed and with l33t substitutions.
+func dictionaryMatches(runes []rune, dictionary map[string]int, pattern string) []strengthMatch {
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		return nil
+	}
+
+	var matches []strengthMatch
+
+	add := func(word []rune, i, j int, reversed, l33t bool) {
+		rank, ok := dictionary[string(word)]
+		if !ok {
+			return
+		}
+
+		token := runes[i : j+1]
+		m := strengthMatch{
+			pattern:  pattern,
+			i:        i,
+			j:        j,
+			rank:     rank,
+			reversed: reversed,
+			l33t:     l33t,
+		}
+
+		upper := uppercaseVariations(token)
+		m.upper = upper > 1
+		m.guesses = float64(rank) * upper
+		if reversed {
+			m.guesses *= 2
+		}
+		if l33t {
+			m.guesses *= l33tVariations(token, word)
+		}
+
+		matches = append(matches, m)
+	}
+
+	variants := l33tVariants(lower)
+
+	for i := range lower {
+		for j := i + 2; j < len(lower); j++ {
+			for v, variant := range variants {
+				word := variant[i : j+1]
+				l33t := v > 0
+				if l33t && string(word) == string(lower[i:j+1]) {
+					continue
+				}
+
+				add(word, i, j, false, l33t)
+				if !l33t && len(word) > 3 {
+					add(reverseRunes(word), i, j, true, false)
+				}
+			}
+		}
+	}
+
+	return matches
+}
+
+func reverseRunes(runes []rune) []rune {
+	r := make([]rune, len(runes))
+	for k, c := range runes {
+		r[len(runes)-1-k] = c
+	}
+
+	return r
+}
+
+func uppercaseVariations(token []rune) float64 {
+	var uppers, lowers int
+	for _, r := range token {
+		switch {
+		case unicode.IsUpper(r):
+			uppers++
+		case unicode.IsLower(r):
+			lowers++
+		}
+	}
+
+	if uppers == 0 {
+		return 1
+	}
+
+	// capitalizing the first or last letter or all letters is tried first
+	if lowers == 0 || (uppers == 1 && (unicode.IsUpper(token[0]) || unicode.IsUpper(token[len(token)-1]))) {
+		return 2
+	}
+
+	variations := 0.0
+	for k := 1; k <= uppers && k <= lowers; k++ {
+		variations += binomial(uppers+lowers, k)
+	}
+
+	return variations
+}
+
+func l33tVariations(token, word []rune) float64 {
+	variations := 1.0
+	seen := make(map[rune]bool)
+
+	for k, r := range word {
+		sub := unicode.ToLower(token[k])
+		if sub == r || seen[sub] {
+			continue
+		}
+		seen[sub] = true
+
+		var subbed, unsubbed int
+		for m, c := range token {
+			switch unicode.ToLower(c) {
+			case sub:
+				subbed++
+			case word[m]:
+				if word[m] == r {
+					unsubbed++
+				}
+			}
+		}
+
+		if unsubbed == 0 {
+			variations *= 2
+			continue
+		}
+
+		v := 0.0
+		for i := 1; i <= subbed && i <= unsubbed; i++ {
+			v += binomial(subbed+unsubbed, i)
+		}
+		variations *= v
+	}
+
+	return variations
+}
+
+func binomial(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r *= float64(n)
+		r /= float64(d)
+		n--
+	}
+
+	return r
+}
+
+type keyPosition struct {
+	row, col int
+	shifted  bool
+}
+
+var keyPositions = func() map[rune]keyPosition {
+	positions := make(map[rune]keyPosition)
+	for row, keys := range keyboardRows {
+		for shifted, chars := range keys {
+			for col, r := range []rune(chars) {
+				positions[r] = keyPosition{row: row, col: col, shifted: shifted == 1}
+			}
+		}
+	}
+
+	return positions
+}()
+
+// keyDirection returns the direction of the step from key a to neighbouring key b, or -1 when they are no neighbours.
+func keyDirection(a, b keyPosition) int {
+	dr, dc := b.row-a.row, b.col-a.col
+
+	switch {
+	case dr == 0 && dc == -1:
+		return 0
+	case dr == 0 && dc == 1:
+		return 1
+	case dr == -1 && dc == 0:
+		return 2
+	case dr == -1 && dc == 1:
+		return 3
+	case dr == 1 && dc == -1:
+		return 4
+	case dr == 1 && dc == 0:
+		return 5
+	default:
+		return -1
+	}
+}
+
+// spatialMatches finds runs of at least three neighbouring keys, like "qwerty" or "zaq1".
+func spatialMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+
+	for i := 0; i < len(runes)-2; {
+		turns, shifted := 0, 0
+		lastDirection := -1
+
+		first, ok := keyPositions[runes[i]]
+		if !ok {
+			i++
+			continue
+		}
+		if first.shifted {
+			shifted++
+		}
+
+		j := i
+		for j+1 < len(runes) {
+			a := keyPositions[runes[j]]
+			b, ok := keyPositions[runes[j+1]]
+			if !ok {
+				break
+			}
+
+			direction := keyDirection(a, b)
+			if direction < 0 {
+				break
+			}
+
+			if direction != lastDirection {
+				turns++
+				lastDirection = direction
+			}
+			if b.shifted {
+				shifted++
+			}
+			j++
+		}
+
+		if j-i+1 >= 3 {
+			matches = append(matches, strengthMatch{
+				pattern: patternSpatial,
+				i:       i,
+				j:       j,
+				guesses: spatialGuesses(j-i+1, turns, shifted),
+			})
+			i = j + 1
+			continue
+		}
+
+		i++
+	}
+
+	return matches
+}
+
+func spatialGuesses(length, turns, shifted int) float64 {
+	guesses := 0.0
+	for l := 2; l <= length; l++ {
+		for t := 1; t <= turns && t <= l-1; t++ {
+			guesses += binomial(l-1, t-1) * keyboardStartingPositions * math.Pow(keyboardAverageDegree, float64(t))
+		}
+	}
+
+	unshifted := length - shifted
+	if shifted > 0 {
+		if unshifted == 0 {
+			guesses *= 2
+		} else {
+			variations := 0.0
+			for k := 1; k <= shifted && k <= unshifted; k++ {
+				variations += binomial(shifted+unshifted, k)
+			}
+			guesses *= variations
+		}
+	}
+
+	return guesses
+}
+
+// sequenceMatches finds runs of at least three characters in alphabetical or numerical order, like "abcd",
+// "Abcd" or "4321".
+func sequenceMatches(runes []rune) []strengthMatch {
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		lower = runes
+	}
+
+	var matches []strengthMatch
+
+	for i := 0; i < len(lower)-2; {
+		delta := lower[i+1] - lower[i]
+		if (delta != 1 && delta != -1) || !sameCharClass(lower[i], lower[i+1]) {
+			i++
+			continue
+		}
+
+		j := i + 1
+		for j+1 < len(lower) && lower[j+1]-lower[j] == delta && sameCharClass(lower[j], lower[j+1]) {
+			j++
+		}
+
+		if j-i+1 >= 3 {
+			base := 26.0
+			switch {
+			case strings.ContainsRune("az019", lower[i]):
+				base = 4
+			case unicode.IsDigit(lower[i]):
+				base = 10
+			}
+
+			guesses := base * float64(j-i+1) * uppercaseVariations(runes[i:j+1])
+			if delta < 0 {
+				guesses *= 2
+			}
+
+			matches = append(matches, strengthMatch{
+				pattern: patternSequence,
+				i:       i,
+				j:       j,
+				guesses: guesses,
+			})
+		}
+
+		i = j
+	}
+
+	return matches
+}
+
+func sameCharClass(a, b rune) bool {
+	switch {
+	case unicode.IsDigit(a):
+		return unicode.IsDigit(b)
+	case unicode.IsLower(a):
+		return unicode.IsLower(b)
+	case unicode.IsUpper(a):
+		return unicode.IsUpper(b)
+	default:
+		return false
+	}
+}
+
+// repeatMatches finds repeated characters or groups, like "aaa" or "abcabc".
+func repeatMatches(runes []rune, userInputs map[string]int) []strengthMatch {
+	var matches []strengthMatch
+
+	for i := 0; i < len(runes)-1; {
+		bestUnit, bestCount := 0, 0
+		for unit := 1; i+2*unit <= len(runes); unit++ {
+			count := 1
+			for i+(count+1)*unit <= len(runes) && string(runes[i+count*unit:i+(count+1)*unit]) == string(runes[i:i+unit]) {
+				count++
+			}
+
+			if count > 1 && unit*count > bestUnit*bestCount {
+				bestUnit, bestCount = unit, count
+			}
+		}
+
+		if bestCount < 2 || bestUnit*bestCount < 3 && bestUnit == 1 {
+			i++
+			continue
+		}
+
+		baseGuesses, _ := mostGuessableSequence(runes[i:i+bestUnit], userInputs)
+		matches = append(matches, strengthMatch{
+			pattern: patternRepeat,
+			i:       i,
+			j:       i + bestUnit*bestCount - 1,
+			guesses: baseGuesses * float64(bestCount),
+		})
+
+		i += bestUnit * bestCount
+	}
+
+	return matches
+}
+
+// dateMatches finds years and dates with or without separators, like "1987", "13-3-87" or "130387".
+func dateMatches(runes []rune) []strengthMatch {
+	var matches []strengthMatch
+
+	referenceYear := time.Now().Year()
+	yearSpace := func(year int) float64 {
+		return math.Max(math.Abs(float64(year-referenceYear)), minYearSpace)
+	}
+
+	for i := range runes {
+		for j := i + 3; j < len(runes) && j-i < 10; j++ {
+			token := string(runes[i : j+1])
+
+			if j-i == 3 {
+				if year, err := strconv.Atoi(token); err == nil && year >= 1900 && year <= 2050 {
+					matches = append(matches, strengthMatch{pattern: patternDate, i: i, j: j, guesses: yearSpace(year)})
+				}
+			}
+
+			year, separator, ok := parseDate(token)
+			if !ok {
+				continue
+			}
+
+			guesses := 365 * yearSpace(year)
+			if separator {
+				guesses *= 4
+			}
+
+			matches = append(matches, strengthMatch{pattern: patternDate, i: i, j: j, guesses: guesses})
+		}
+	}
+
+	return matches
+}
+
+// parseDate recognizes day, month and year in any common order, returning the year.
+func parseDate(token string) (year int, separator bool, ok bool) {
+	var parts []string
+
+	fields := strings.FieldsFunc(token, func(r rune) bool {
+		return strings.ContainsRune(" /\\_.-", r)
+	})
+
+	switch {
+	case len(fields) == 3 && strings.Trim(token, "0123456789 /\\_.-") == "":
+		parts = fields
+		separator = true
+	case len(fields) == 1 && strings.Trim(token, "0123456789") == "" && len(token) >= 4 && len(token) <= 8:
+		// without separators every split into three parts is tried
+		for a := 1; a <= 4 && a < len(token)-1; a++ {
+			for b := a + 1; b-a <= 4 && b < len(token); b++ {
+				if y, ok := dayMonthYear(token[:a], token[a:b], token[b:]); ok {
+					return y, false, true
+				}
+			}
+		}
+		return 0, false, false
+	default:
+		return 0, false, false
+	}
+
+	y, ok := dayMonthYear(parts[0], parts[1], parts[2])
+
+	return y, separator, ok
+}
+
+func dayMonthYear(a, b, c string) (int, bool) {
+	var nums [3]int
+	for k, s := range []string{a, b, c} {
+		if len(s) == 0 || len(s) == 3 || len(s) > 4 {
+			return 0, false
+		}
+
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, false
+		}
+		nums[k] = n
+	}
+
+	orders := [][3]int{{0, 1, 2}, {1, 0, 2}, {2, 1, 0}, {2, 0, 1}} // dmy, mdy, ymd, ydm
+	for _, o := range orders {
+		day, month, year := nums[o[0]], nums[o[1]], nums[o[2]]
+		yearDigits := []string{a, b, c}[o[2]]
+
+		if len([]string{a, b, c}[o[0]]) > 2 || len([]string{a, b, c}[o[1]]) > 2 {
+			continue
+		}
+
+		if len(yearDigits) == 2 {
+			if year > 50 {
+				year += 1900
+			} else {
+				year += 2000
+			}
+		}
+
+		if day >= 1 && day <= 31 && month >= 1 && month <= 12 && year >= 1900 && year <= 2050 {
+			return year, true
+		}
+	}
+
+	return 0, false
+}
+
+// strengthFeedback gives suggestions based on the patterns found in a weak password.
+func strengthFeedback(runes []rune, sequence []strengthMatch) []string {
+	var feedback []string
+	seen := make(map[string]bool)
+
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			feedback = append(feedback, s)
+		}
+	}
+
+	// the longest patterns first, they weaken the password most
+	sorted := append([]strengthMatch(nil), sequence...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].j-sorted[a].i > sorted[b].j-sorted[b].i
+	})
+
+	for _, m := range sorted {
+		switch m.pattern {
+		case patternDictionary:
+			whole := m.i == 0 && m.j == len(runes)-1
+			switch {
+			case whole && m.common && m.rank <= 10:
+				add("this is a top-10 common password")
+			case whole && m.common:
+				add("this is similar to a commonly used password")
+			case whole:
+				add("a single word is easy to guess")
+			default:
+				add("avoid common words and passwords")
+			}
+			if m.reversed {
+				add("reversed words aren't much harder to guess")
+			}
+			if m.l33t {
+				add("predictable substitutions like '@' instead of 'a' don't help very much")
+			}
+			if m.upper {
+				add("capitalization doesn't help very much")
+			}
+		case patternUserInput:
+			add("avoid using (parts of) your e-mail address")
+		case patternSpatial:
+			add("avoid keyboard patterns like 'qwerty'")
+		case patternSequence:
+			add("avoid sequences like 'abcd' or '1234'")
+		case patternRepeat:
+			add("avoid repeats like 'aaa' or 'abcabc'")
+		case patternDate:
+			add("avoid dates and years that are associated with you")
+		}
+	}
+
+	add("add another word or two, uncommon words are better")
+
+	return feedback
+}
@@ -0,0 +1,90 @@
+package user_registration
+
+import (
+	"strings"
+	"testing"
+)
+
+func hasFeedback(s PasswordStrength, substr string) bool {
+	for _, f := range s.Feedback {
+		if strings.Contains(f, substr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestEstimatePasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		maxScore uint
+		minScore uint
+		feedback string
+	}{
+		{"password", 0, 0, "top-10 common password"},
+		{"zxcvfr4", 2, 0, "keyboard patterns"},
+		{"abcdefg1!", 1, 0, "sequences"},
+		{"Abcdefg1!", 1, 0, "sequences"},
+		{"aaaaaaaaaaaa", 1, 0, "repeats"},
+		{"13-03-1987", 2, 0, "dates"},
+		{"P@ssw0rd", 1, 0, "substitutions"},
+		{"correcthorsebatterystaple", 4, 4, ""},
+		{"Zyxw-Plank-19", 4, 3, ""},
+	}
+
+	for _, tt := range tests {
+		s := EstimatePasswordStrength(tt.password)
+		if s.Score > tt.maxScore || s.Score < tt.minScore {
+			t.Errorf("%s: score %d, want %d to %d", tt.password, s.Score, tt.minScore, tt.maxScore)
+		}
+
+		if tt.feedback != "" && !hasFeedback(s, tt.feedback) {
+			t.Errorf("%s: feedback %q does not mention %q", tt.password, s.Feedback, tt.feedback)
+		}
+	}
+
+	if s := EstimatePasswordStrength(""); s.Score != 0 {
+		t.Errorf("empty password: score %d", s.Score)
+	}
+}
+
+func TestEstimatePasswordStrengthUserInputs(t *testing.T) {
+	const email = "Bob@Example.com"
+
+	for _, password := range []string{"bob2024!Bob", "BOB2024!bob", "b0b2024!B0b", "bobexample2024", "2024!bob"} {
+		s := EstimatePasswordStrength(password, email)
+		if s.Score > 2 {
+			t.Errorf("%s: score %d, want at most 2", password, s.Score)
+		}
+
+		if !hasFeedback(s, "e-mail address") {
+			t.Errorf("%s: feedback %q does not mention the e-mail address", password, s.Feedback)
+		}
+	}
+
+	// without the user inputs the same password is stronger
+	with := EstimatePasswordStrength("bob2024!Bob", email)
+	without := EstimatePasswordStrength("bob2024!Bob")
+	if with.Guesses >= without.Guesses {
+		t.Errorf("guesses with user inputs %g, without %g", with.Guesses, without.Guesses)
+	}
+}
+
+func TestStrengthRule(t *testing.T) {
+	rule := StrengthRule{MinScore: 3}
+
+	ok, feedback := rule.CheckFeedback("bob2024!Bob", "bob@example.com")
+	if ok || len(feedback) == 0 {
+		t.Errorf("weak password: ok = %v, feedback %q", ok, feedback)
+	}
+
+	if ok != rule.Check("bob2024!Bob", "bob@example.com") {
+		t.Error("Check and CheckFeedback disagree")
+	}
+
+	ok, _ = rule.CheckFeedback("correcthorsebatterystaple", "bob@example.com")
+	if !ok {
+		t.Error("strong password rejected")
+	}
+}
@@ -0,0 +1,243 @@
+package user_registration
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// the error correction codewords of "HELLO WORLD" as version 1-M, a well known worked example
+func TestReedSolomonRemainder(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := reedSolomonRemainder(data, reedSolomonDivisor(len(want)))
+	if !bytes.Equal(got, want) {
+		t.Errorf("remainder = %v, want %v", got, want)
+	}
+}
+
+func TestQRCodeVersion(t *testing.T) {
+	// byte mode capacity at level M: 14 bytes in version 1, 26 in version 2, 2331 in version 40
+	tests := []struct {
+		length  int
+		version int
+	}{
+		{1, 1},
+		{14, 1},
+		{15, 2},
+		{26, 2},
+		{27, 3},
+		{2331, 40},
+	}
+
+	for _, tt := range tests {
+		qr, err := encodeQRCode(bytes.Repeat([]byte("a"), tt.length))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", tt.length, err)
+		}
+
+		if qr.version != tt.version || qr.size != tt.version*4+17 {
+			t.Errorf("%d bytes: version %d size %d, want version %d", tt.length, qr.version, qr.size, tt.version)
+		}
+	}
+
+	_, err := encodeQRCode(bytes.Repeat([]byte("a"), 2332))
+	if err != errQRCodeTooLong {
+		t.Errorf("too long: err = %v", err)
+	}
+}
+
+// the 15 format bits for level M and masks 0 to 7, from the QR code specification
+var qrFormatBitsM = [8]int{0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0}
+
+// readFormatBits reads both copies of the format bits.
+func readFormatBits(qr *qrCode) (int, int) {
+	var a, b int
+	for i := 0; i <= 5; i++ {
+		a |= bit(qr.modules[i][8]) << i
+	}
+	a |= bit(qr.modules[7][8]) << 6
+	a |= bit(qr.modules[8][8]) << 7
+	a |= bit(qr.modules[8][7]) << 8
+	for i := 9; i < 15; i++ {
+		a |= bit(qr.modules[8][14-i]) << i
+	}
+
+	for i := 0; i < 8; i++ {
+		b |= bit(qr.modules[8][qr.size-1-i]) << i
+	}
+	for i := 8; i < 15; i++ {
+		b |= bit(qr.modules[qr.size-15+i][8]) << i
+	}
+
+	return a, b
+}
+
+func bit(dark bool) int {
+	if dark {
+		return 1
+	}
+	return 0
+}
+
+func qrMaskFunc(mask int) func(x, y int) bool {
+	return []func(x, y int) bool{
+		func(x, y int) bool { return (x+y)%2 == 0 },
+		func(x, y int) bool { return y%2 == 0 },
+		func(x, y int) bool { return x%3 == 0 },
+		func(x, y int) bool { return (x+y)%3 == 0 },
+		func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+		func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+		func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+		func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+	}[mask]
+}
+
+// decodeQRCode reads back the text of a single block QR code (versions 1 to 3 at level M):
+// it finds the mask from the format bits, reads the codewords in zigzag order, checks the
+// error correction codewords and decodes the byte mode segment.
+func decodeQRCode(t *testing.T, qr *qrCode) string {
+	t.Helper()
+
+	a, b := readFormatBits(qr)
+	if a != b {
+		t.Fatalf("format bits differ: %015b %015b", a, b)
+	}
+
+	mask := -1
+	for m, bits := range qrFormatBitsM {
+		if bits == a {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("format bits %015b are not level M", a)
+	}
+	invert := qrMaskFunc(mask)
+
+	var bits []bool
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vert
+				}
+				if !qr.isFunction[y][x] {
+					bits = append(bits, qr.modules[y][x] != invert(x, y))
+				}
+			}
+		}
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i := range codewords {
+		for j := 0; j < 8; j++ {
+			if bits[i*8+j] {
+				codewords[i] |= 1 << (7 - j)
+			}
+		}
+	}
+
+	eccLen := qrECCCodewordsPerBlock[qr.version]
+	data := codewords[:len(codewords)-eccLen]
+	ecc := codewords[len(codewords)-eccLen:]
+	if !bytes.Equal(reedSolomonRemainder(data, reedSolomonDivisor(eccLen)), ecc) {
+		t.Fatal("error correction codewords do not match the data")
+	}
+
+	if data[0]>>4 != 0x4 {
+		t.Fatalf("mode %04b, want byte mode", data[0]>>4)
+	}
+
+	n := int(data[0]&0x0f)<<4 | int(data[1]>>4)
+	text := make([]byte, n)
+	for i := range text {
+		text[i] = data[1+i]<<4 | data[2+i]>>4
+	}
+
+	return string(text)
+}
+
+func TestQRCodeRoundTrip(t *testing.T) {
+	for _, text := range []string{"a", "HELLO WORLD", "otpauth://totp/x?secret=GEZDGNBVGY3TQOJQ"} {
+		qr, err := encodeQRCode([]byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := decodeQRCode(t, qr); got != text {
+			t.Errorf("decoded %q, want %q", got, text)
+		}
+	}
+}
+
+func TestQRCodeFunctionPatterns(t *testing.T) {
+	qr, err := encodeQRCode([]byte(strings.Repeat("a", 200)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the finder patterns: a dark ring, a light ring and a dark 3x3 center, separated by light modules
+	for _, corner := range [][2]int{{3, 3}, {qr.size - 4, 3}, {3, qr.size - 4}} {
+		for dy := -3; dy <= 3; dy++ {
+			for dx := -3; dx <= 3; dx++ {
+				dist := maxInt(absInt(dx), absInt(dy))
+				if qr.modules[corner[1]+dy][corner[0]+dx] != (dist != 2) {
+					t.Fatalf("finder pattern at %v wrong at %d,%d", corner, dx, dy)
+				}
+			}
+		}
+	}
+
+	// the version information of version 7 and up, e.g. 0x07C94 for version 7
+	if qr.version < 7 {
+		t.Fatalf("version %d, want at least 7", qr.version)
+	}
+
+	var version int
+	for i := 0; i < 18; i++ {
+		version |= bit(qr.modules[i/3][qr.size-11+i%3]) << i
+	}
+	if version>>12 != qr.version {
+		t.Errorf("version bits %018b do not hold version %d", version, qr.version)
+	}
+
+	qr7 := &qrCode{version: 7, size: 45, modules: make([][]bool, 45), isFunction: make([][]bool, 45)}
+	for i := range qr7.modules {
+		qr7.modules[i] = make([]bool, 45)
+		qr7.isFunction[i] = make([]bool, 45)
+	}
+	qr7.drawVersion()
+
+	version = 0
+	for i := 0; i < 18; i++ {
+		version |= bit(qr7.modules[i/3][qr7.size-11+i%3]) << i
+	}
+	if version != 0x07C94 {
+		t.Errorf("version 7 bits = %#x, want 0x07c94", version)
+	}
+}
+
+func TestQRCodePNG(t *testing.T) {
+	b, err := qrCodePNG("HELLO WORLD", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// version 1 has 21 modules, plus the quiet zone on both sides
+	if want := (21 + 2*qrQuietZone) * 3; img.Bounds().Dx() != want || img.Bounds().Dy() != want {
+		t.Errorf("image is %v, want %dx%d", img.Bounds(), want, want)
+	}
+}
@@ -0,0 +1,62 @@
+package user_registration
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const reauthenticationExpiry = 15 * time.Minute
+
+var errHasPassword = errors.New("user has a password to confirm changes with")
+
+// RequestReauthentication sends a link to a user without a password, which is then asked for instead of
+// the password to confirm a change to the account, such as turning off two-factor authentication. This way
+// a stolen session alone cannot take over the account. The code in the link can be used once and expires
+// after a short time.
+func (u *UserRegistration) RequestReauthentication(ctx context.Context, email string) error {
+	if !u.HasMailSender() {
+		return errors.New("no e-mail sender configured")
+	}
+
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	if user.HasPassword() {
+		return errHasPassword
+	}
+
+	token, _, err := u.issueToken(ctx, TokenPurposeReauthentication, user.Email, "", reauthenticationExpiry)
+	if err != nil {
+		return err
+	}
+
+	return u.mailSender.Reauthenticate(ctx, user.Address(), token)
+}
+
+// reauthenticate checks what a logged in user confirms a change to the account with: the password, or
+// for users without one the code of a link sent by RequestReauthentication. It returns the error to
+// report when the check fails.
+func (u *UserRegistration) reauthenticate(ctx context.Context, user *User, password string) (*FieldError, error) {
+	if user.HasPassword() {
+		ok, _, err := verifyPasswordHash(u.passwordHasher, password, user.Password)
+		if err != nil || ok {
+			return nil, err
+		}
+
+		return newFieldError(FieldPassword, CodeInvalidCredentials, ErrInvalidCredentials), nil
+	}
+
+	t, err := u.useToken(ctx, TokenPurposeReauthentication, password)
+	if errors.Is(err, errTokenUsed) || errors.Is(err, errTokenExpired) || (err == nil && (t == nil || t.Email != user.Email)) {
+		return newFieldError(FieldPassword, CodeReauthenticationRequired, ErrReauthenticationRequired), nil
+	}
+
+	return nil, err
+}
@@ -0,0 +1,167 @@
+package user_registration
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+//go:embed disposable-domains.txt
+var bundledDisposableDomains string
+
+// RegistrationPolicy restricts the email domains that can be used to register. Domains are given
+// exactly, like "example.com", or with wildcards, like "*.example.com" for all its subdomains.
+type RegistrationPolicy struct {
+	AllowedDomains    []string    // when set, only addresses of these domains can register
+	DeniedDomains     []string    // addresses of these domains cannot register
+	BlockDisposable   bool        // rejects addresses of disposable e-mail services
+	DisposableDomains *DomainList // optional, defaults to the bundled list of disposable e-mail services
+}
+
+// DomainList is a list of domains read from a file with a domain per line, lines starting with #
+// are ignored. A domain in the list also covers its subdomains.
+type DomainList struct {
+	mu      sync.RWMutex
+	path    string
+	domains map[string]bool
+}
+
+// LoadDomainList reads a domain list from a file, which can be updated and read again with Reload.
+func LoadDomainList(path string) (*DomainList, error) {
+	l := &DomainList{path: path}
+
+	err := l.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// DefaultDisposableDomains returns the bundled list of disposable e-mail services.
+func DefaultDisposableDomains() *DomainList {
+	l := new(DomainList)
+	l.domains, _ = readDomainList(strings.NewReader(bundledDisposableDomains))
+
+	return l
+}
+
+// Reload reads the file of the list again.
+func (l *DomainList) Reload() error {
+	if l.path == "" {
+		return nil
+	}
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	domains, err := readDomainList(f)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.domains = domains
+	l.mu.Unlock()
+
+	return nil
+}
+
+func readDomainList(r io.Reader) (map[string]bool, error) {
+	domains := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		domain, err := toASCIIDomain(line)
+		if err != nil {
+			continue
+		}
+
+		domains[domain] = true
+	}
+
+	return domains, scanner.Err()
+}
+
+// Contains reports whether the domain or one of its parent domains is in the list.
+func (l *DomainList) Contains(domain string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for {
+		if l.domains[domain] {
+			return true
+		}
+
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+	}
+}
+
+// matchDomain reports whether the domain matches one of the exact or wildcard patterns.
+func matchDomain(domain string, patterns []string) bool {
+	for _, p := range patterns {
+		p, err := toASCIIDomain(strings.TrimSpace(p))
+		if err != nil {
+			continue
+		}
+
+		if strings.HasPrefix(p, "*.") && strings.HasSuffix(domain, p[1:]) {
+			return true
+		}
+
+		if ok, _ := path.Match(p, domain); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkEmailDomain returns the policy error for a normalized address, or nil when it is accepted.
+func (u *UserRegistration) checkEmailDomain(email string) error {
+	p := u.registrationPolicy
+	if p == nil {
+		return nil
+	}
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+
+	if len(p.AllowedDomains) > 0 && !matchDomain(domain, p.AllowedDomains) {
+		return ErrDomainNotAllowed
+	}
+
+	if matchDomain(domain, p.DeniedDomains) {
+		return ErrDomainNotAllowed
+	}
+
+	if p.BlockDisposable && p.DisposableDomains.Contains(domain) {
+		return ErrDisposableEmail
+	}
+
+	return nil
+}
+
+// emailDomainError turns a policy error of checkEmailDomain into a field error.
+func emailDomainError(field string, err error) *FieldError {
+	if err == ErrDisposableEmail {
+		return newFieldError(field, CodeDisposableEmail, err)
+	}
+
+	return newFieldError(field, CodeDomainNotAllowed, err)
+}
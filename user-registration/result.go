@@ -0,0 +1,123 @@
+package user_registration
+
+import "errors"
+
+type ErrorCode string
+
+const (
+	CodeEmailTaken               ErrorCode = "email_taken"
+	CodePasswordPolicy           ErrorCode = "password_policy"
+	CodePasswordMismatch         ErrorCode = "password_mismatch"
+	CodeNotConfirmed             ErrorCode = "not_confirmed"
+	CodeInvalidCredentials       ErrorCode = "invalid_credentials"
+	CodeAccountLocked            ErrorCode = "account_locked"
+	CodeInvalidTwoFactorCode     ErrorCode = "invalid_two_factor_code"
+	CodeEmailUnchanged           ErrorCode = "email_unchanged"
+	CodeBreachedPassword         ErrorCode = "breached_password"
+	CodePasswordReused           ErrorCode = "password_reused"
+	CodeInvalidEmail             ErrorCode = "invalid_email"
+	CodeDomainNotAllowed         ErrorCode = "email_domain_not_allowed"
+	CodeDisposableEmail          ErrorCode = "disposable_email"
+	CodeInvitationRequired       ErrorCode = "invitation_required"
+	CodeAwaitingApproval         ErrorCode = "awaiting_approval"
+	CodeReauthenticationRequired ErrorCode = "reauthentication_required"
+)
+
+// form fields the errors in a Result refer to
+const (
+	FieldEmail           = "email"
+	FieldPassword        = "password"
+	FieldConfirmPassword = "confirm-password"
+	FieldCode            = "code"
+	FieldNewEmail        = "new-email"
+	FieldCurrentPassword = "current-password"
+)
+
+var (
+	ErrEmailTaken               = errors.New("email already registered")
+	ErrPasswordPolicy           = errors.New("password does not fulfill the requirements")
+	ErrPasswordMismatch         = errors.New("passwords are not the same")
+	ErrNotConfirmed             = errors.New("email not confirmed yet, check your inbox")
+	ErrInvalidCredentials       = errors.New("invalid email and/or password")
+	ErrAccountLocked            = errors.New("account temporarily locked, try again later or reset your password")
+	ErrInvalidTwoFactorCode     = errors.New("invalid authentication code")
+	ErrEmailUnchanged           = errors.New("this already is your e-mail address")
+	ErrBreachedPassword         = errors.New("this password appears in a data breach, choose another one")
+	ErrPasswordReused           = errors.New("you have used this password before, choose another one")
+	ErrDomainNotAllowed         = errors.New("e-mail addresses of this domain cannot be used")
+	ErrDisposableEmail          = errors.New("disposable e-mail addresses cannot be used")
+	ErrInvitationRequired       = errors.New("registration is by invitation only")
+	ErrAwaitingApproval         = errors.New("your registration is awaiting approval")
+	ErrReauthenticationRequired = errors.New("confirm it is you with the link sent to your e-mail address")
+)
+
+// FieldError is a validation error for a single field. It wraps one of the sentinel errors,
+// so errors.Is can be used to check for it. Rules holds the failed password requirements and
+// Feedback the suggestions to make a too weak password stronger.
+type FieldError struct {
+	Field    string    `json:"field"`
+	Code     ErrorCode `json:"code"`
+	Message  string    `json:"message"`
+	Rules    []string  `json:"rules,omitempty"`
+	Feedback []string  `json:"feedback,omitempty"`
+	err      error
+}
+
+func newFieldError(field string, code ErrorCode, err error) *FieldError {
+	return &FieldError{
+		Field:   field,
+		Code:    code,
+		Message: err.Error(),
+		err:     err,
+	}
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.err
+}
+
+// Result is returned by Register, Login and Reset. When Errors is empty the action succeeded,
+// except when Login sets TwoFactorRequired: the password was correct, but the login has to be
+// completed with VerifyTwoFactor, or PasswordExpired: the password has to be changed first.
+type Result struct {
+	User              *User         `json:"-"`
+	Errors            []*FieldError `json:"errors"`
+	TwoFactorRequired bool          `json:"two_factor_required,omitempty"`
+	RecoveryCodes     []string      `json:"recovery_codes,omitempty"`
+	DeletionCancelled bool          `json:"deletion_cancelled,omitempty"`
+	PasswordExpired   bool          `json:"password_expired,omitempty"`
+}
+
+func (r *Result) OK() bool {
+	return len(r.Errors) == 0 && !r.TwoFactorRequired && !r.PasswordExpired
+}
+
+// Get returns the first error for a field, or nil if there is none.
+func (r *Result) Get(field string) *FieldError {
+	for _, e := range r.Errors {
+		if e.Field == field {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// Err returns all field errors joined, or nil if there are none.
+func (r *Result) Err() error {
+	var errs []error
+	for _, e := range r.Errors {
+		errs = append(errs, e)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *Result) add(e *FieldError) *Result {
+	r.Errors = append(r.Errors, e)
+	return r
+}
@@ -0,0 +1,162 @@
+package user_registration
+
+import (
+	"context"
+	"time"
+)
+
+// UserCounter is implemented by a UserSource that can count its users, which FirstUserIsAdmin requires.
+type UserCounter interface {
+	Count(ctx context.Context) (int, error)
+}
+
+// HasPermission reports whether the user has the permission, granted directly or through one of the
+// roles in the RolePermissions of the config. RoleAdmin has every permission.
+func (u *UserRegistration) HasPermission(user User, permission string) bool {
+	if user.HasRole(RoleAdmin) || contains(user.Permissions, permission) {
+		return true
+	}
+
+	for _, role := range user.Roles {
+		if contains(u.rolePermissions[role], permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GrantRole adds the role to the user.
+func (u *UserRegistration) GrantRole(ctx context.Context, email, role string) (*User, error) {
+	return u.updateUser(ctx, email, func(user *User) bool {
+		if user.HasRole(role) {
+			return false
+		}
+
+		user.Roles = append(user.Roles, role)
+		return true
+	})
+}
+
+// RevokeRole removes the role from the user.
+func (u *UserRegistration) RevokeRole(ctx context.Context, email, role string) (*User, error) {
+	return u.updateUser(ctx, email, func(user *User) bool {
+		var changed bool
+		user.Roles, changed = remove(user.Roles, role)
+		return changed
+	})
+}
+
+// GrantPermission gives the user the permission, apart from its roles.
+func (u *UserRegistration) GrantPermission(ctx context.Context, email, permission string) (*User, error) {
+	return u.updateUser(ctx, email, func(user *User) bool {
+		if contains(user.Permissions, permission) {
+			return false
+		}
+
+		user.Permissions = append(user.Permissions, permission)
+		return true
+	})
+}
+
+// RevokePermission takes away a permission given with GrantPermission, permissions of roles are not affected.
+func (u *UserRegistration) RevokePermission(ctx context.Context, email, permission string) (*User, error) {
+	return u.updateUser(ctx, email, func(user *User) bool {
+		var changed bool
+		user.Permissions, changed = remove(user.Permissions, permission)
+		return changed
+	})
+}
+
+// updateUser applies the change to the user and saves it when the change reports so.
+func (u *UserRegistration) updateUser(ctx context.Context, email string, change func(user *User) bool) (*User, error) {
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if !change(user) {
+		return user, nil
+	}
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// bootstrapAdmin makes a new user admin when its address is one of the AdminEmails, or when it is the
+// first user and FirstUserIsAdmin is set. An admin does not have to be approved.
+func (u *UserRegistration) bootstrapAdmin(ctx context.Context, user *User) error {
+	admin := u.isAdminEmail(user.Email)
+
+	if !admin && u.firstUserIsAdmin {
+		count, err := u.userSource.(UserCounter).Count(ctx)
+		if err != nil {
+			return err
+		}
+
+		admin = count == 0
+	}
+
+	if admin {
+		if !user.HasRole(RoleAdmin) {
+			user.Roles = append(user.Roles, RoleAdmin)
+		}
+		user.ApprovalPending = false
+	}
+
+	return nil
+}
+
+// grantConfiguredAdmin gives an existing user, whose address has been added to the AdminEmails later on,
+// the admin role and reports whether it did. Such a user awaiting approval is approved as well, otherwise
+// nobody could approve the first admin.
+func (u *UserRegistration) grantConfiguredAdmin(user *User) bool {
+	if !u.isAdminEmail(user.Email) || user.HasRole(RoleAdmin) && !user.ApprovalPending {
+		return false
+	}
+
+	if !user.HasRole(RoleAdmin) {
+		user.Roles = append(user.Roles, RoleAdmin)
+	}
+
+	if user.ApprovalPending {
+		now := time.Now()
+		user.ApprovalPending = false
+		user.ApprovedAt = &now
+	}
+
+	return true
+}
+
+func (u *UserRegistration) isAdminEmail(key string) bool {
+	return contains(u.adminEmails, key)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remove returns the values without value and whether it was found.
+func remove(values []string, value string) ([]string, bool) {
+	for i, v := range values {
+		if v == value {
+			return append(values[:i:i], values[i+1:]...), true
+		}
+	}
+
+	return values, false
+}
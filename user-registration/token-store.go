@@ -0,0 +1,130 @@
+package user_registration
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type TokenPurpose string
+
+const (
+	TokenPurposeConfirm          TokenPurpose = "confirm"
+	TokenPurposeReset            TokenPurpose = "reset"
+	TokenPurposeEmailChange      TokenPurpose = "email-change"
+	TokenPurposeEmailRevert      TokenPurpose = "email-revert"
+	TokenPurposeInvitation       TokenPurpose = "invitation"
+	TokenPurposeMagicLink        TokenPurpose = "magic-link"
+	TokenPurposeReauthentication TokenPurpose = "reauthentication"
+	TokenPurposeRefresh          TokenPurpose = "refresh"
+	TokenPurposeRefreshFamily    TokenPurpose = "refresh-family"
+	tokenPurposeLegacyReset      TokenPurpose = ""
+)
+
+// Token is what is stored for a token sent out to a user. The token itself is never stored, only its hash.
+// Data holds purpose specific data, e.g. the new address for an e-mail change.
+type Token struct {
+	Purpose   TokenPurpose
+	Email     string
+	Data      string `json:",omitempty"`
+	Expiry    time.Time
+	SingleUse bool       `json:",omitempty"`
+	UsedAt    *time.Time `json:",omitempty"`
+}
+
+// TokenStore keeps track of the tokens that have been sent out, by the hash of the token.
+// Get returns a nil pointer when the hash is unknown, expired tokens may still be returned until purged.
+// Use atomically marks a single-use token as used and returns the token as it was before, so a token
+// that was used already has UsedAt set.
+type TokenStore interface {
+	Set(ctx context.Context, hash string, token Token) error
+	Get(ctx context.Context, hash string) (*Token, error)
+	Use(ctx context.Context, hash string, at time.Time) (*Token, error)
+	Delete(ctx context.Context, hash string) error
+}
+
+// MemoryTokenStore is the default TokenStore, tokens are lost on restart. Expired tokens are purged
+// while setting tokens, at most once per purge interval.
+type MemoryTokenStore struct {
+	mu       sync.Mutex
+	tokens   map[string]Token
+	purgedAt time.Time
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens:   make(map[string]Token),
+		purgedAt: time.Now(),
+	}
+}
+
+func (s *MemoryTokenStore) Set(_ context.Context, hash string, token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.purgedAt) >= defaultPurgeInterval {
+		s.purge()
+	}
+
+	s.tokens[hash] = token
+
+	return nil
+}
+
+// Purge removes the expired tokens.
+func (s *MemoryTokenStore) Purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+}
+
+func (s *MemoryTokenStore) purge() {
+	now := time.Now()
+	for h, t := range s.tokens {
+		if now.After(t.Expiry) {
+			delete(s.tokens, h)
+		}
+	}
+
+	s.purgedAt = now
+}
+
+func (s *MemoryTokenStore) Get(_ context.Context, hash string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, nil
+	}
+
+	return &token, nil
+}
+
+func (s *MemoryTokenStore) Use(_ context.Context, hash string, at time.Time) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, nil
+	}
+
+	if token.SingleUse && token.UsedAt == nil {
+		used := token
+		used.UsedAt = &at
+		s.tokens[hash] = used
+	}
+
+	return &token, nil
+}
+
+func (s *MemoryTokenStore) Delete(_ context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tokens, hash)
+
+	return nil
+}
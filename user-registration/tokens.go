@@ -0,0 +1,130 @@
+package user_registration
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const tokenLength = 32
+
+var (
+	errTokenUsed    = errors.New("token already used")
+	errTokenExpired = errors.New("token expired")
+)
+
+// newToken returns a random token that does not contain any information, and its hash.
+func newToken() (string, string, error) {
+	b := make([]byte, tokenLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func equalHashes(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// issueToken stores a new single-use token for the purpose and returns the token to send out.
+func (u *UserRegistration) issueToken(ctx context.Context, purpose TokenPurpose, email, data string, ttl time.Duration) (string, string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = u.tokens.Set(ctx, hash, Token{
+		Purpose:   purpose,
+		Email:     email,
+		Data:      data,
+		Expiry:    time.Now().Add(ttl),
+		SingleUse: true,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, hash, nil
+}
+
+// lookupToken returns the stored token for the purpose without using it, nil if it is unknown or for
+// another purpose. Expiry and use are left to the caller.
+func (u *UserRegistration) lookupToken(ctx context.Context, purpose TokenPurpose, token string) (*Token, string, error) {
+	if token == "" {
+		return nil, "", nil
+	}
+
+	hash := hashToken(token)
+
+	t, err := u.tokens.Get(ctx, hash)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if t == nil || t.Purpose != purpose {
+		return nil, "", nil
+	}
+
+	return t, hash, nil
+}
+
+// useToken marks the token as used. It returns nil when the token is unknown or for another purpose.
+// When it expired or was used before the token is returned with errTokenExpired or errTokenUsed.
+func (u *UserRegistration) useToken(ctx context.Context, purpose TokenPurpose, token string) (*Token, error) {
+	t, hash, err := u.lookupToken(ctx, purpose, token)
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.After(t.Expiry) {
+		return t, errTokenExpired
+	}
+
+	t, err = u.tokens.Use(ctx, hash, now)
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	if t.UsedAt != nil {
+		return t, errTokenUsed
+	}
+
+	return t, nil
+}
+
+// legacyCodesAccepted reports whether codes in the format of earlier versions, which embed the
+// email address, are still accepted.
+func (u *UserRegistration) legacyCodesAccepted() bool {
+	return time.Now().Before(u.legacyCodesUntil)
+}
+
+// emailFromLegacyCode returns the email address a code of earlier versions was prefixed with.
+func emailFromLegacyCode(code string) (string, error) {
+	decoded, err := base64.URLEncoding.DecodeString(code)
+	if err != nil {
+		return "", err
+	}
+
+	email, _, ok := strings.Cut(string(decoded), ":")
+	if !ok || email == "" {
+		return "", errors.New("code does not contain an email address")
+	}
+
+	return email, nil
+}
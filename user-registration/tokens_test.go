@@ -0,0 +1,243 @@
+package user_registration
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testTokenStores(t *testing.T) map[string]TokenStore {
+	t.Helper()
+
+	file, err := NewFileTokenStore(filepath.Join(t.TempDir(), "tokens.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(file.Close)
+
+	return map[string]TokenStore{
+		"memory": NewMemoryTokenStore(),
+		"file":   file,
+	}
+}
+
+func TestUseToken(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range testTokenStores(t) {
+		t.Run(name, func(t *testing.T) {
+			u := &UserRegistration{tokens: store}
+
+			token, hash, err := u.issueToken(ctx, TokenPurposeReset, "bob@example.com", "data", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if hash == token || hash != hashToken(token) {
+				t.Error("the token is not stored by its hash")
+			}
+
+			if stored, _ := store.Get(ctx, token); stored != nil {
+				t.Error("token found under the token itself")
+			}
+
+			// another purpose does not use up the token
+			tok, err := u.useToken(ctx, TokenPurposeConfirm, token)
+			if tok != nil || err != nil {
+				t.Errorf("other purpose: token %v, err %v", tok, err)
+			}
+
+			tok, err = u.useToken(ctx, TokenPurposeReset, token)
+			if err != nil || tok == nil || tok.Email != "bob@example.com" || tok.Data != "data" {
+				t.Fatalf("first use: token %v, err %v", tok, err)
+			}
+
+			tok, err = u.useToken(ctx, TokenPurposeReset, token)
+			if !errors.Is(err, errTokenUsed) || tok == nil {
+				t.Errorf("second use: token %v, err %v", tok, err)
+			}
+
+			tok, err = u.useToken(ctx, TokenPurposeReset, "unknown")
+			if tok != nil || err != nil {
+				t.Errorf("unknown token: token %v, err %v", tok, err)
+			}
+
+			tok, err = u.useToken(ctx, TokenPurposeReset, "")
+			if tok != nil || err != nil {
+				t.Errorf("empty token: token %v, err %v", tok, err)
+			}
+		})
+	}
+}
+
+func TestUseTokenExpired(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range testTokenStores(t) {
+		t.Run(name, func(t *testing.T) {
+			u := &UserRegistration{tokens: store}
+
+			token, _, err := u.issueToken(ctx, TokenPurposeConfirm, "bob@example.com", "", -time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tok, err := u.useToken(ctx, TokenPurposeConfirm, token)
+			if !errors.Is(err, errTokenExpired) || tok == nil {
+				t.Errorf("token %v, err %v", tok, err)
+			}
+		})
+	}
+}
+
+func TestMemoryTokenStorePurge(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryTokenStore()
+
+	_ = s.Set(ctx, "expired", Token{Expiry: time.Now().Add(-time.Second)})
+	_ = s.Set(ctx, "valid", Token{Expiry: time.Now().Add(time.Hour)})
+
+	// expired tokens are kept until purged, so their use can be reported as expired
+	if tok, _ := s.Get(ctx, "expired"); tok == nil {
+		t.Error("expired token purged on set")
+	}
+
+	s.Purge()
+
+	if tok, _ := s.Get(ctx, "expired"); tok != nil {
+		t.Error("expired token not purged")
+	}
+
+	if tok, _ := s.Get(ctx, "valid"); tok == nil {
+		t.Error("valid token purged")
+	}
+
+	s.purgedAt = time.Now().Add(-defaultPurgeInterval)
+	_ = s.Set(ctx, "expired", Token{Expiry: time.Now().Add(-time.Second)})
+	_ = s.Set(ctx, "new", Token{Expiry: time.Now().Add(time.Hour)})
+
+	if tok, _ := s.Get(ctx, "expired"); tok == nil {
+		t.Error("purged again before the purge interval passed")
+	}
+}
+
+func TestFileTokenStorePersists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	s, err := NewFileTokenStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = s.Set(ctx, "hash", Token{Purpose: TokenPurposeReset, Email: "bob@example.com", Expiry: time.Now().Add(time.Hour), SingleUse: true})
+	_, _ = s.Use(ctx, "hash", time.Now())
+	s.Close()
+
+	s, err = NewFileTokenStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tok, err := s.Get(ctx, "hash")
+	if err != nil || tok == nil || tok.UsedAt == nil {
+		t.Errorf("after reopening: token %v, err %v", tok, err)
+	}
+}
+
+func TestLegacyCodesTransition(t *testing.T) {
+	ctx := context.Background()
+	code := base64.URLEncoding.EncodeToString([]byte("bob@example.com:0123456789"))
+
+	tests := []struct {
+		name  string
+		until time.Time
+		want  error
+	}{
+		{"default period", time.Time{}, nil},
+		{"period over", time.Now().Add(-time.Minute), ErrInvalidConfirmationCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, users, _ := newTestUserRegistration(t, &NewUserRegistrationConfig{LegacyCodesUntil: tt.until})
+
+			// as registered by an earlier version
+			err := users.Insert(ctx, User{Email: "bob@example.com", Password: "hash", ConfirmationCode: code})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = u.Confirm(ctx, code); err != tt.want {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// the default period ends
+	u, _, _ := newTestUserRegistration(t, nil)
+	if u.legacyCodesUntil.IsZero() || u.legacyCodesUntil.After(time.Now().Add(defaultConfirmationExpiry)) {
+		t.Errorf("legacy codes accepted until %v", u.legacyCodesUntil)
+	}
+}
+
+func TestFileTokenStoreSaveFails(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "store")
+
+	err := os.Mkdir(dir, 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewFileTokenStore(filepath.Join(dir, "tokens.json"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	kept := Token{Purpose: TokenPurposeReset, Email: "bob@example.com", Expiry: time.Now().Add(time.Hour), SingleUse: true}
+	if err = s.Set(ctx, "kept", kept); err != nil {
+		t.Fatal(err)
+	}
+
+	// the store cannot be written anymore, what is in memory must stay as it is on disk
+	if err = os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Set(ctx, "new", kept); err == nil {
+		t.Fatal("Set succeeded")
+	}
+	if tok, _ := s.Get(ctx, "new"); tok != nil {
+		t.Error("token set although it was not saved")
+	}
+
+	changed := kept
+	changed.Email = "eve@example.com"
+	if err = s.Set(ctx, "kept", changed); err == nil {
+		t.Fatal("Set succeeded")
+	}
+	if tok, _ := s.Get(ctx, "kept"); tok == nil || tok.Email != kept.Email {
+		t.Errorf("token replaced although it was not saved: %v", tok)
+	}
+
+	if err = s.Delete(ctx, "kept"); err == nil {
+		t.Fatal("Delete succeeded")
+	}
+	if tok, _ := s.Get(ctx, "kept"); tok == nil {
+		t.Error("token deleted although it was not saved")
+	}
+
+	if _, err = s.Use(ctx, "kept", time.Now()); err == nil {
+		t.Fatal("Use succeeded")
+	}
+	if tok, _ := s.Get(ctx, "kept"); tok == nil || tok.UsedAt != nil {
+		t.Errorf("token used although it was not saved: %v", tok)
+	}
+}
@@ -0,0 +1,352 @@
+package user_registration
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTOTPIssuer            = "User Registration"
+	totpPeriod                   = 30
+	totpDigits                   = 6
+	totpSkew                     = 1 // number of periods before and after the current one that are accepted
+	totpSecretLength             = 20
+	recoveryCodeCount            = 10
+	recoveryCodeLength           = 10
+	defaultQRCodeModuleWidth     = 6
+	recoveryCodeGroupSize    int = 5
+)
+
+var (
+	ErrTwoFactorNotEnabled           = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled       = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorEnrollmentNotStarted = errors.New("two-factor authentication enrollment not started")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPEnrollment is the data an authenticator app needs to set up two-factor authentication.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// QRCode returns the otpauth:// URI as a PNG image, moduleWidth pixels per QR code module.
+// Zero means a default width.
+func (e *TOTPEnrollment) QRCode(moduleWidth int) ([]byte, error) {
+	if moduleWidth == 0 {
+		moduleWidth = defaultQRCodeModuleWidth
+	}
+
+	return qrCodePNG(e.URI, moduleWidth)
+}
+
+// BeginTOTPEnrollment generates a new secret for the user. Two-factor authentication is only enabled
+// after EnableTOTP has verified a first code generated with it.
+func (u *UserRegistration) BeginTOTPEnrollment(ctx context.Context, email string) (*TOTPEnrollment, error) {
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret := make([]byte, totpSecretLength)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPSecret = totpEncoding.EncodeToString(secret)
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.totpEnrollment(user), nil
+}
+
+// TOTPEnrollment returns the pending enrollment of the user, or nil if there is none.
+func (u *UserRegistration) TOTPEnrollment(ctx context.Context, email string) (*TOTPEnrollment, error) {
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || user.TOTPSecret == "" || user.TOTPEnabledAt != nil {
+		return nil, nil
+	}
+
+	return u.totpEnrollment(user), nil
+}
+
+func (u *UserRegistration) totpEnrollment(user *User) *TOTPEnrollment {
+	label := url.PathEscape(u.totpIssuer + ":" + user.Address())
+
+	params := url.Values{}
+	params.Set("secret", user.TOTPSecret)
+	params.Set("issuer", u.totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	// authenticator apps do not all decode + as a space
+	query := strings.ReplaceAll(params.Encode(), "+", "%20")
+
+	return &TOTPEnrollment{
+		Secret: user.TOTPSecret,
+		URI:    fmt.Sprintf("otpauth://totp/%s?%s", label, query),
+	}
+}
+
+// EnableTOTP verifies a first code of the pending enrollment and enables two-factor authentication.
+// The returned result holds the recovery codes, these are only stored hashed and cannot be shown again.
+func (u *UserRegistration) EnableTOTP(ctx context.Context, email, code string) (*Result, error) {
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorEnrollmentNotStarted
+	}
+
+	res := new(Result)
+
+	step, ok := validateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return res.add(newFieldError(FieldCode, CodeInvalidTwoFactorCode, ErrInvalidTwoFactorCode)), nil
+	}
+
+	codes, hashed, err := getRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user.TOTPEnabledAt = &now
+	user.TOTPLastStep = step
+	user.RecoveryCodes = hashed
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	res.User = user
+	res.RecoveryCodes = codes
+
+	return res, nil
+}
+
+// DisableTOTP turns two-factor authentication off, after checking the password of the user. Users
+// without a password pass the code of a link sent by RequestReauthentication instead.
+func (u *UserRegistration) DisableTOTP(ctx context.Context, email, password string) (*Result, error) {
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	res := new(Result)
+
+	fieldErr, err := u.reauthenticate(ctx, user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if fieldErr != nil {
+		return res.add(fieldErr), nil
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPEnabledAt = nil
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	res.User = user
+
+	return res, nil
+}
+
+// VerifyTwoFactor completes a login for which Login returned TwoFactorRequired. The code is either
+// a code from the authenticator app or one of the recovery codes, which can be used only once.
+// Only call it for an email address that passed Login, it does not check the password.
+func (u *UserRegistration) VerifyTwoFactor(ctx context.Context, email, code string) (*Result, error) {
+	user, err := u.selectUser(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil || user.TOTPEnabledAt == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	res := new(Result)
+
+	if user.isLocked() {
+		return res.add(newFieldError(FieldCode, CodeAccountLocked, ErrAccountLocked)), nil
+	}
+
+	step, ok := validateTOTP(user.TOTPSecret, code, time.Now())
+	if ok && step > user.TOTPLastStep {
+		user.TOTPLastStep = step
+	} else {
+		ok = user.useRecoveryCode(code)
+	}
+
+	if !ok {
+		if u.lockoutPolicy != nil {
+			u.lockoutPolicy.registerFailedLogin(user)
+
+			err = u.userSource.Update(ctx, *user)
+			if err != nil {
+				return nil, err
+			}
+
+			if user.isLocked() {
+				return res.add(newFieldError(FieldCode, CodeAccountLocked, ErrAccountLocked)), nil
+			}
+		}
+
+		return res.add(newFieldError(FieldCode, CodeInvalidTwoFactorCode, ErrInvalidTwoFactorCode)), nil
+	}
+
+	user.unlock()
+
+	res.DeletionCancelled, err = u.cancelDeletion(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.userSource.Update(ctx, *user)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.passwordExpired(user) {
+		res.PasswordExpired = true
+		return res, nil
+	}
+
+	res.User = user
+
+	return res, nil
+}
+
+// validateTOTP checks the code against the periods around t and returns the matching time step.
+func validateTOTP(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	current := t.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// totpCode implements the HOTP algorithm of RFC 4226 for the given time step.
+func totpCode(key []byte, step int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// getRecoveryCodes returns new recovery codes and their hashes.
+func getRecoveryCodes() ([]string, []string, error) {
+	var codes, hashed []string
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeLength)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		code := totpEncoding.EncodeToString(b)[:recoveryCodeLength]
+		codes = append(codes, code[:recoveryCodeGroupSize]+"-"+code[recoveryCodeGroupSize:])
+		hashed = append(hashed, hashRecoveryCode(code))
+	}
+
+	return codes, hashed, nil
+}
+
+// recovery codes are random, so a plain SHA-256 is sufficient to store them
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// useRecoveryCode removes the recovery code from the user and reports whether it was valid.
+func (u *User) useRecoveryCode(code string) bool {
+	hashed := hashRecoveryCode(code)
+
+	for i, h := range u.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hashed)) == 1 {
+			u.RecoveryCodes = append(u.RecoveryCodes[:i:i], u.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
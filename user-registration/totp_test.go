@@ -0,0 +1,229 @@
+package user_registration
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// the SHA-1 test vectors of RFC 6238 appendix B, truncated to 6 digits
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if code := totpCode(key, tt.unix/totpPeriod); code != tt.code {
+			t.Errorf("time %d: code = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name  string
+		steps int64
+		ok    bool
+	}{
+		{"current", 0, true},
+		{"previous", -1, true},
+		{"next", 1, true},
+		{"two before", -2, false},
+		{"two after", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := validateTOTP(secret, totpCode(key, current+tt.steps), now)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+
+			if ok && step != current+tt.steps {
+				t.Errorf("step = %d, want %d", step, current+tt.steps)
+			}
+		})
+	}
+
+	if _, ok := validateTOTP(secret, "12345", now); ok {
+		t.Error("code with too few digits accepted")
+	}
+
+	// lower case secrets, as some users type them
+	if _, ok := validateTOTP("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", totpCode(key, current), now); !ok {
+		t.Error("lower case secret rejected")
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ctx := context.Background()
+	u, _, mail := newTestUserRegistration(t, nil)
+	registerConfirmed(t, u, mail, "bob@example.com")
+
+	_, err := u.EnableTOTP(ctx, "bob@example.com", "123456")
+	if err != ErrTwoFactorEnrollmentNotStarted {
+		t.Errorf("EnableTOTP before enrolling: err = %v", err)
+	}
+
+	enrollment, err := u.BeginTOTPEnrollment(ctx, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := totpCode(key, time.Now().Unix()/totpPeriod)
+
+	res, err := u.EnableTOTP(ctx, "bob@example.com", code)
+	if err != nil || !res.OK() {
+		t.Fatalf("EnableTOTP: %v %v", err, res.Err())
+	}
+
+	recoveryCodes := res.RecoveryCodes
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", len(recoveryCodes), recoveryCodeCount)
+	}
+
+	if _, err = u.BeginTOTPEnrollment(ctx, "bob@example.com"); err != ErrTwoFactorAlreadyEnabled {
+		t.Errorf("BeginTOTPEnrollment when enabled: err = %v", err)
+	}
+	if _, err = u.EnableTOTP(ctx, "bob@example.com", code); err != ErrTwoFactorAlreadyEnabled {
+		t.Errorf("EnableTOTP when enabled: err = %v", err)
+	}
+
+	res, err = u.Login(ctx, "bob@example.com", testPassword)
+	if err != nil || !res.TwoFactorRequired {
+		t.Fatalf("Login: TwoFactorRequired = %v, err = %v", res.TwoFactorRequired, err)
+	}
+
+	// the code used to enable cannot be used again
+	res, err = u.VerifyTwoFactor(ctx, "bob@example.com", code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Get(FieldCode) == nil || res.Get(FieldCode).Code != CodeInvalidTwoFactorCode {
+		t.Errorf("replayed code: %v", res.Err())
+	}
+
+	res, err = u.VerifyTwoFactor(ctx, "bob@example.com", recoveryCodes[0])
+	if err != nil || !res.OK() {
+		t.Fatalf("recovery code: %v %v", err, res.Err())
+	}
+
+	res, err = u.VerifyTwoFactor(ctx, "bob@example.com", recoveryCodes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OK() {
+		t.Error("recovery code accepted twice")
+	}
+}
+
+func TestTOTPEnrollmentQRCode(t *testing.T) {
+	e := &TOTPEnrollment{URI: "otpauth://totp/User%20Registration:bob@example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=User%20Registration"}
+
+	png, err := e.QRCode(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(png) < 8 || string(png[1:4]) != "PNG" {
+		t.Error("QRCode did not return a PNG")
+	}
+}
+
+func TestDisableTOTPWithoutPassword(t *testing.T) {
+	ctx := context.Background()
+	u, users, mail := newTestUserRegistration(t, nil)
+
+	// as created by an OpenID Connect login, with two-factor authentication enabled since
+	now := time.Now()
+	for _, email := range []string{"alice@example.com", "eve@example.com"} {
+		err := users.Insert(ctx, User{Email: email, CreatedAt: now, ConfirmedAt: &now, TOTPSecret: "secret", TOTPEnabledAt: &now})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := u.RequestReauthentication(ctx, "eve@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCode := mail.last("reauthentication")
+
+	// a stolen session alone is not enough, nor is the link of another user
+	for _, code := range []string{"", "guess", otherCode} {
+		res, err := u.DisableTOTP(ctx, "alice@example.com", code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := res.Get(FieldPassword); e == nil || e.Code != CodeReauthenticationRequired {
+			t.Errorf("%q: %v", code, res.Err())
+		}
+	}
+
+	err = u.RequestReauthentication(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := mail.last("reauthentication")
+
+	res, err := u.DisableTOTP(ctx, "alice@example.com", code)
+	if err != nil || !res.OK() {
+		t.Fatalf("DisableTOTP: %v %v", err, res.Err())
+	}
+	if res.User.TOTPEnabledAt != nil || res.User.TOTPSecret != "" {
+		t.Error("two-factor authentication still enabled")
+	}
+
+	res, err = u.DisableTOTP(ctx, "alice@example.com", code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OK() {
+		t.Error("link used twice")
+	}
+}
+
+func TestDisableTOTPWithPassword(t *testing.T) {
+	ctx := context.Background()
+	u, _, mail := newTestUserRegistration(t, nil)
+	registerConfirmed(t, u, mail, "bob@example.com")
+
+	// users with a password confirm with it
+	err := u.RequestReauthentication(ctx, "bob@example.com")
+	if err != errHasPassword {
+		t.Errorf("RequestReauthentication: err = %v", err)
+	}
+
+	res, err := u.DisableTOTP(ctx, "bob@example.com", "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := res.Get(FieldPassword); e == nil || e.Code != CodeInvalidCredentials {
+		t.Errorf("wrong password: %v", res.Err())
+	}
+
+	res, err = u.DisableTOTP(ctx, "bob@example.com", testPassword)
+	if err != nil || !res.OK() {
+		t.Errorf("DisableTOTP: %v %v", err, res.Err())
+	}
+}
@@ -1,32 +1,57 @@
 package user_registration
 
 import (
-	"crypto/rand"
-	"encoding/base64"
+	"context"
 	"errors"
 	"fmt"
-	"golang.org/x/crypto/bcrypt"
 	"strings"
+	"sync"
 	"time"
-	"unicode"
 )
 
 const (
-	maxBytesPerHash          int  = 72
 	defaultPasswordMinLength uint = 8
 	defaultPasswordMaxLength uint = 32
+	resetCodeExpiry               = time.Hour
 )
 
-type resetCode struct {
-	Email  string
-	Expiry time.Time
-}
+var (
+	ErrInvalidResetCode        = errors.New("password reset code invalid or expired")
+	ErrInvalidConfirmationCode = errors.New("invalid confirmation code")
+	ErrUserNotFound            = errors.New("user does not exist")
+)
 
 type UserRegistration struct {
 	userSource           UserSource
 	mailSender           MailSender
 	passwordRequirements *PasswordRequirements
-	resetCodes           map[string]resetCode
+	passwordRules        []PasswordRule
+	emailNormalizer      EmailNormalizer
+	registrationPolicy   *RegistrationPolicy
+	tokens               TokenStore
+	passwordHasher       PasswordHasher
+	lockoutPolicy        *LockoutPolicy
+	totpIssuer           string
+	confirmationExpiry   time.Duration
+	resendInterval       time.Duration
+	legacyCodesUntil     time.Time
+	deletionSchedule     DeletionSchedule
+	deletionGracePeriod  time.Duration
+	inviteOnly           bool
+	invitationExpiry     time.Duration
+	approvalRequired     bool
+	approvals            ApprovalQueue
+	rolePermissions      map[string][]string
+	adminEmails          []string
+	firstUserIsAdmin     bool
+	bootstrapMu          sync.Mutex
+	magicLinkMode        MagicLinkMode
+	magicLinkExpiry      time.Duration
+	signingKeys          []signingKey
+	accessTokenIssuer    string
+	accessTokenAudience  string
+	accessTokenExpiry    time.Duration
+	refreshTokenExpiry   time.Duration
 }
 
 type PasswordRequirements struct {
@@ -36,12 +61,55 @@ type PasswordRequirements struct {
 	MinUppers   *uint
 	MinNumbers  *uint
 	MinSpecials *uint
+
+	// optional, the minimum score (0-4) of EstimatePasswordStrength, with the email address as user input
+	MinStrengthScore *uint
+
+	// optional, checked after the rules for the fields above
+	Rules []PasswordRule
+
+	// optional, the number of most recent passwords, including the current one, that cannot be used again
+	HistorySize uint
+
+	// optional, passwords older than this have to be changed on the next login
+	MaxPasswordAge time.Duration
+
+	// optional, the period before the password expires in which PasswordExpiry warns the user
+	PasswordExpiryWarning time.Duration
+
+	// optional, rejects passwords known from data breaches, e.g. a PwnedPasswords
+	BreachedPasswordChecker BreachedPasswordChecker
 }
 
 type NewUserRegistrationConfig struct {
 	UserSource           UserSource
 	MailSender           MailSender
 	PasswordRequirements *PasswordRequirements
+	TokenStore           TokenStore          // optional, defaults to a MemoryTokenStore
+	PasswordHasher       PasswordHasher      // optional, defaults to an Argon2idHasher
+	LockoutPolicy        *LockoutPolicy      // optional, accounts are never locked when nil
+	TOTPIssuer           string              // shown in authenticator apps, defaults to "User Registration"
+	ConfirmationExpiry   time.Duration       // optional, defaults to 48 hours
+	ResendInterval       time.Duration       // minimum time between confirmation e-mails to an address, defaults to 1 minute
+	LegacyCodesUntil     time.Time           // codes of earlier versions, which contain the email address, are accepted until then, defaults to ConfirmationExpiry after NewUserRegistration
+	DeletionSchedule     DeletionSchedule    // optional, defaults to a MemoryDeletionSchedule
+	DeletionGracePeriod  time.Duration       // time between requesting and carrying out an account deletion, defaults to 14 days
+	EmailNormalizer      EmailNormalizer     // optional, defaults to a DefaultEmailNormalizer
+	RegistrationPolicy   *RegistrationPolicy // optional, restricts the email domains that can register
+	InviteOnly           bool                // Register is rejected, users can only register with AcceptInvitation
+	InvitationExpiry     time.Duration       // optional, defaults to 7 days
+	ApprovalRequired     bool                // new users cannot log in until they are approved
+	ApprovalQueue        ApprovalQueue       // optional, defaults to a MemoryApprovalQueue
+	RolePermissions      map[string][]string // the permissions of each role, RoleAdmin has every permission
+	AdminEmails          []string            // users with these addresses get the admin role
+	FirstUserIsAdmin     bool                // the first user to register gets the admin role, the UserSource has to implement UserCounter
+	MagicLink            MagicLinkMode       // optional, whether users can log in with a link sent by e-mail
+	MagicLinkExpiry      time.Duration       // optional, defaults to 15 minutes
+	AccessTokenKeys      []SigningKey        // optional, the first one signs access tokens, all of them verify, so keys can be rotated
+	AccessTokenIssuer    string              // optional, the iss claim of access tokens
+	AccessTokenAudience  string              // optional, the aud claim of access tokens
+	AccessTokenExpiry    time.Duration       // optional, defaults to 15 minutes
+	RefreshTokenExpiry   time.Duration       // optional, defaults to 30 days
 }
 
 func NewUserRegistration(cfg *NewUserRegistrationConfig) (*UserRegistration, error) {
@@ -57,11 +125,141 @@ func NewUserRegistration(cfg *NewUserRegistrationConfig) (*UserRegistration, err
 		return nil, errors.New("PasswordRequirements cannot be a nil pointer")
 	}
 
+	tokens := cfg.TokenStore
+	if tokens == nil {
+		tokens = NewMemoryTokenStore()
+	}
+
+	passwordHasher := cfg.PasswordHasher
+	if passwordHasher == nil {
+		passwordHasher = new(Argon2idHasher)
+	}
+
+	totpIssuer := cfg.TOTPIssuer
+	if totpIssuer == "" {
+		totpIssuer = defaultTOTPIssuer
+	}
+
+	confirmationExpiry := cfg.ConfirmationExpiry
+	if confirmationExpiry == 0 {
+		confirmationExpiry = defaultConfirmationExpiry
+	}
+
+	// codes sent before the upgrade stay valid as long as those sent after it
+	legacyCodesUntil := cfg.LegacyCodesUntil
+	if legacyCodesUntil.IsZero() {
+		legacyCodesPeriod := confirmationExpiry
+		if legacyCodesPeriod < resetCodeExpiry {
+			legacyCodesPeriod = resetCodeExpiry
+		}
+
+		legacyCodesUntil = time.Now().Add(legacyCodesPeriod)
+	}
+
+	resendInterval := cfg.ResendInterval
+	if resendInterval == 0 {
+		resendInterval = defaultResendInterval
+	}
+
+	deletionSchedule := cfg.DeletionSchedule
+	if deletionSchedule == nil {
+		deletionSchedule = NewMemoryDeletionSchedule()
+	}
+
+	deletionGracePeriod := cfg.DeletionGracePeriod
+	if deletionGracePeriod == 0 {
+		deletionGracePeriod = defaultDeletionGracePeriod
+	}
+
+	emailNormalizer := cfg.EmailNormalizer
+	if emailNormalizer == nil {
+		emailNormalizer = new(DefaultEmailNormalizer)
+	}
+
+	invitationExpiry := cfg.InvitationExpiry
+	if invitationExpiry == 0 {
+		invitationExpiry = defaultInvitationExpiry
+	}
+
+	approvals := cfg.ApprovalQueue
+	if approvals == nil {
+		approvals = NewMemoryApprovalQueue()
+	}
+
+	magicLinkExpiry := cfg.MagicLinkExpiry
+	if magicLinkExpiry == 0 {
+		magicLinkExpiry = defaultMagicLinkExpiry
+	}
+
+	signingKeys, err := newSigningKeys(cfg.AccessTokenKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenExpiry := cfg.AccessTokenExpiry
+	if accessTokenExpiry == 0 {
+		accessTokenExpiry = defaultAccessTokenExpiry
+	}
+
+	refreshTokenExpiry := cfg.RefreshTokenExpiry
+	if refreshTokenExpiry == 0 {
+		refreshTokenExpiry = defaultRefreshTokenExpiry
+	}
+
+	if cfg.FirstUserIsAdmin {
+		if _, ok := cfg.UserSource.(UserCounter); !ok {
+			return nil, errors.New("FirstUserIsAdmin requires a UserSource that implements UserCounter")
+		}
+	}
+
+	adminEmails := make([]string, 0, len(cfg.AdminEmails))
+	for _, email := range cfg.AdminEmails {
+		key, err := emailNormalizer.Normalize(email)
+		if err != nil {
+			return nil, fmt.Errorf("admin e-mail address %s: %w", email, err)
+		}
+		adminEmails = append(adminEmails, key)
+	}
+
+	var registrationPolicy *RegistrationPolicy
+	if cfg.RegistrationPolicy != nil {
+		p := *cfg.RegistrationPolicy
+		if p.BlockDisposable && p.DisposableDomains == nil {
+			p.DisposableDomains = DefaultDisposableDomains()
+		}
+		registrationPolicy = &p
+	}
+
 	return &UserRegistration{
 		userSource:           cfg.UserSource,
 		mailSender:           cfg.MailSender,
 		passwordRequirements: cfg.PasswordRequirements,
-		resetCodes:           make(map[string]resetCode),
+		passwordRules:        cfg.PasswordRequirements.passwordRules(),
+		tokens:               tokens,
+		passwordHasher:       passwordHasher,
+		lockoutPolicy:        cfg.LockoutPolicy,
+		totpIssuer:           totpIssuer,
+		confirmationExpiry:   confirmationExpiry,
+		resendInterval:       resendInterval,
+		legacyCodesUntil:     legacyCodesUntil,
+		deletionSchedule:     deletionSchedule,
+		deletionGracePeriod:  deletionGracePeriod,
+		emailNormalizer:      emailNormalizer,
+		registrationPolicy:   registrationPolicy,
+		inviteOnly:           cfg.InviteOnly,
+		invitationExpiry:     invitationExpiry,
+		approvalRequired:     cfg.ApprovalRequired,
+		approvals:            approvals,
+		rolePermissions:      cfg.RolePermissions,
+		adminEmails:          adminEmails,
+		firstUserIsAdmin:     cfg.FirstUserIsAdmin,
+		magicLinkMode:        cfg.MagicLink,
+		magicLinkExpiry:      magicLinkExpiry,
+		signingKeys:          signingKeys,
+		accessTokenIssuer:    cfg.AccessTokenIssuer,
+		accessTokenAudience:  cfg.AccessTokenAudience,
+		accessTokenExpiry:    accessTokenExpiry,
+		refreshTokenExpiry:   refreshTokenExpiry,
 	}, nil
 }
 
@@ -69,364 +267,527 @@ func (u *UserRegistration) HasMailSender() bool {
 	return u.mailSender != nil
 }
 
-func (u *UserRegistration) Register(email, password, confirmPassword string) (bool, string, string, string, error) {
-	user, err := u.userSource.Select(email)
+func (u *UserRegistration) Register(ctx context.Context, email, password, confirmPassword string) (*Result, error) {
+	if u.inviteOnly {
+		return new(Result).add(newFieldError(FieldEmail, CodeInvitationRequired, ErrInvitationRequired)), nil
+	}
+
+	return u.register(ctx, email, password, confirmPassword, nil, "")
+}
+
+// register creates the user, either on its own or by accepting the invitation with the code.
+func (u *UserRegistration) register(ctx context.Context, email, password, confirmPassword string, invitation *Invitation, code string) (*Result, error) {
+	key, err := u.emailNormalizer.Normalize(email)
+	if err != nil {
+		return new(Result).add(newFieldError(FieldEmail, CodeInvalidEmail, ErrInvalidEmail)), nil
+	}
+
+	// the domain of an invitation has been checked when it was created
+	if invitation == nil {
+		err = u.checkEmailDomain(key)
+		if err != nil {
+			return new(Result).add(emailDomainError(FieldEmail, err)), nil
+		}
+	}
+
+	user, err := u.selectUser(ctx, email)
 	if err != nil {
-		return false, "", "", "", err
+		return nil, err
 	}
 
 	if user != nil {
-		return false, "email already registered", "", "", nil
+		return new(Result).add(newFieldError(FieldEmail, CodeEmailTaken, ErrEmailTaken)), nil
 	}
 
-	ok := u.verifyPassword(password)
-	if !ok {
-		return false, "", u.passwordError(), "", nil
+	res, err := u.checkNewPassword(ctx, nil, key, password, confirmPassword)
+	if err != nil {
+		return nil, err
 	}
 
-	if password != confirmPassword {
-		return false, "", "", "passwords are not the same", nil
+	if !res.OK() {
+		return res, nil
+	}
+
+	hashed, err := u.passwordHasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user = &User{
+		Email:             key,
+		DisplayEmail:      strings.TrimSpace(email),
+		Password:          hashed,
+		PasswordChangedAt: &now,
+		CreatedAt:         now,
+		ConfirmedAt:       nil,
+		ApprovalPending:   u.approvalRequired,
 	}
 
-	var code = ""
+	var token = ""
 
-	if u.HasMailSender() {
-		code, err = getCode(email)
+	if invitation != nil {
+		err = u.acceptInvitation(ctx, user, invitation, code)
+		if err != nil {
+			return nil, err
+		}
+	} else if u.HasMailSender() {
+		token, err = u.newConfirmationToken(ctx, user)
 		if err != nil {
-			return false, "", "", "", err
+			return nil, err
 		}
+	}
 
-		defer func() {
-			err = u.mailSender.Confirm(email, code)
-			if err != nil {
-				fmt.Println(err)
-			}
-		}()
+	err = u.insertUser(ctx, user)
+	if err != nil {
+		return nil, err
 	}
 
-	hashed, err := hashPassword(password)
+	if token != "" {
+		err = u.mailSender.Confirm(ctx, user.Address(), token)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	res.User = user
+
+	return res, nil
+}
+
+// insertUser stores a new user, which becomes admin when bootstrapAdmin says so, and adds it to the
+// approval queue when it has to be approved.
+func (u *UserRegistration) insertUser(ctx context.Context, user *User) error {
+	// the count of the users must not change before this user is inserted
+	if u.firstUserIsAdmin {
+		u.bootstrapMu.Lock()
+		defer u.bootstrapMu.Unlock()
+	}
+
+	err := u.bootstrapAdmin(ctx, user)
 	if err != nil {
-		return false, "", "", "", err
+		return err
 	}
 
-	err = u.userSource.Insert(User{
-		Email:            email,
-		Password:         hashed,
-		ConfirmationCode: code,
-		CreatedAt:        time.Now(),
-		ConfirmedAt:      nil,
-	})
+	err = u.userSource.Insert(ctx, *user)
 	if err != nil {
-		return false, "", "", "", err
+		return err
+	}
+
+	if user.ApprovalPending {
+		return u.approvals.Add(ctx, user.Email)
 	}
 
-	return true, "", "", "", nil
+	return nil
 }
 
-func (u *UserRegistration) Reset(code, password, confirmPassword string) (bool, string, string, error) {
-	email, err := u.ValidateResetCode(code)
+func (u *UserRegistration) Reset(ctx context.Context, code, password, confirmPassword string) (*Result, error) {
+	email, err := u.ValidateResetCode(ctx, code)
 	if err != nil {
-		return false, "", "", err
+		return nil, err
 	}
 
-	ok := u.verifyPassword(password)
-	if !ok {
-		return false, u.passwordError(), "", nil
+	user, err := u.userSource.Select(ctx, email)
+	if err != nil {
+		return nil, err
 	}
 
-	if password != confirmPassword {
-		return false, "", "passwords are not the same", nil
+	if user == nil {
+		return nil, ErrUserNotFound
 	}
 
-	hashed, err := hashPassword(password)
+	res, err := u.checkNewPassword(ctx, user, email, password, confirmPassword)
 	if err != nil {
-		return false, "", "", err
+		return nil, err
+	}
+
+	if !res.OK() {
+		return res, nil
 	}
 
-	user, err := u.userSource.Select(email)
+	hashed, err := u.passwordHasher.Hash(password)
 	if err != nil {
-		return false, "", "", err
+		return nil, err
 	}
 
-	if user == nil {
-		return false, "", "", errors.New("user does not exist")
+	// the code is only used up now, so the form can be submitted again after a validation error
+	err = u.useResetCode(ctx, code)
+	if err != nil {
+		return nil, err
 	}
 
-	user.Password = hashed
+	u.setPassword(user, hashed)
+	user.SessionVersion++ // whoever knew the old password is logged out
+	user.unlock()
 	if user.ConfirmedAt == nil {
 		now := time.Now()
 		user.ConfirmedAt = &now
 	}
 
-	err = u.userSource.Update(*user)
+	err = u.userSource.Update(ctx, *user)
 	if err != nil {
-		return false, "", "", err
+		return nil, err
 	}
 
-	delete(u.resetCodes, code)
+	res.User = user
 
-	return true, "", "", nil
+	return res, nil
 }
 
-func getCode(prefix string) (string, error) {
-	randomBytes := make([]byte, 32)
-	_, err := rand.Read(randomBytes)
-	if err != nil {
-		return "", err
+// checkNewPassword validates a new password of the user with the email address against the
+// requirements, the password history and its confirmation. The user is nil for a new registration.
+func (u *UserRegistration) checkNewPassword(ctx context.Context, user *User, email, password, confirmPassword string) (*Result, error) {
+	res := new(Result)
+
+	failed, feedback := u.verifyPassword(password, email)
+	if len(failed) > 0 {
+		e := newFieldError(FieldPassword, CodePasswordPolicy, ErrPasswordPolicy)
+		e.Message = passwordError(failed)
+		e.Rules = failed
+		e.Feedback = feedback
+		if len(feedback) > 0 {
+			e.Message += fmt.Sprintf(" Hint: %s.", strings.Join(feedback, "; "))
+		}
+		return res.add(e), nil
+	}
+
+	if u.passwordRequirements.BreachedPasswordChecker != nil {
+		breached, err := u.passwordRequirements.BreachedPasswordChecker.IsBreached(ctx, password)
+		if err != nil {
+			return nil, err
+		}
+
+		if breached {
+			return res.add(newFieldError(FieldPassword, CodeBreachedPassword, ErrBreachedPassword)), nil
+		}
 	}
 
-	if prefix != "" {
-		randomBytes = append([]byte(prefix+":"), randomBytes...)
+	if user != nil {
+		reused, err := u.passwordReused(user, password)
+		if err != nil {
+			return nil, err
+		}
+
+		if reused {
+			return res.add(newFieldError(FieldPassword, CodePasswordReused, ErrPasswordReused)), nil
+		}
+	}
+
+	if password != confirmPassword {
+		return res.add(newFieldError(FieldConfirmPassword, CodePasswordMismatch, ErrPasswordMismatch)), nil
 	}
-	return base64.URLEncoding.EncodeToString(randomBytes), nil
+
+	return res, nil
 }
 
-func (u *UserRegistration) Login(email, password string) (*User, string, string, error) {
-	user, err := u.userSource.Select(email)
+func (u *UserRegistration) Login(ctx context.Context, email, password string) (*Result, error) {
+	if u.magicLinkMode == MagicLinkInsteadOfPassword {
+		return nil, ErrPasswordLoginDisabled
+	}
+
+	user, err := u.selectUser(ctx, email)
 	if err != nil {
-		return nil, "", "", err
+		return nil, err
 	}
 
 	if user != nil {
-		if checkPasswordHash(password, user.Password) {
+		deleted, err := u.deletionDue(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+
+		if deleted {
+			user = nil
+		}
+	}
+
+	res := new(Result)
+
+	if user != nil {
+		if user.isLocked() {
+			return res.add(newFieldError(FieldEmail, CodeAccountLocked, ErrAccountLocked)), nil
+		}
+
+		ok, rehash, err := verifyPasswordHash(u.passwordHasher, password, user.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
 			if u.HasMailSender() && user.ConfirmedAt == nil {
-				return nil, "email not confirmed yet, check your inbox", "", nil
+				return res.add(newFieldError(FieldEmail, CodeNotConfirmed, ErrNotConfirmed)), nil
+			}
+
+			changed := u.grantConfiguredAdmin(user)
+
+			if user.ApprovalPending {
+				return res.add(newFieldError(FieldEmail, CodeAwaitingApproval, ErrAwaitingApproval)), nil
 			}
 
-			return user, "", "", nil
+			// with two-factor authentication the lockout is only reset once the second factor is verified
+			twoFactorRequired := user.TOTPEnabledAt != nil
+
+			if !twoFactorRequired {
+				changed = user.unlock() || changed
+
+				// logging in during the grace period cancels a requested deletion
+				res.DeletionCancelled, err = u.cancelDeletion(ctx, user)
+				if err != nil {
+					return nil, err
+				}
+
+				changed = res.DeletionCancelled || changed
+			}
+
+			if rehash {
+				changed = u.rehashPassword(user, password) || changed
+			}
+
+			if changed {
+				// failing to save does not fail the login, it is simply tried again next time
+				err = u.userSource.Update(ctx, *user)
+				if err != nil {
+					fmt.Println(err)
+				}
+			}
+
+			if twoFactorRequired {
+				res.TwoFactorRequired = true
+				return res, nil
+			}
+
+			if u.passwordExpired(user) {
+				res.PasswordExpired = true
+				return res, nil
+			}
+
+			res.User = user
+			return res, nil
 		}
-	}
 
-	return nil, "invalid email and/or password", "invalid email and/or password", nil
-}
+		if u.lockoutPolicy != nil {
+			u.lockoutPolicy.registerFailedLogin(user)
 
-func (u *UserRegistration) ValidateResetCode(code string) (string, error) {
-	t, ok := u.resetCodes[code]
-	if !ok {
-		return "", errors.New("password reset code invalid or expired")
-	}
+			err = u.userSource.Update(ctx, *user)
+			if err != nil {
+				return nil, err
+			}
 
-	if time.Now().After(t.Expiry) {
-		return "", errors.New("password reset code invalid or expired")
+			if user.isLocked() {
+				return res.add(newFieldError(FieldEmail, CodeAccountLocked, ErrAccountLocked)), nil
+			}
+		}
 	}
 
-	return t.Email, nil
+	res.add(newFieldError(FieldEmail, CodeInvalidCredentials, ErrInvalidCredentials))
+	res.add(newFieldError(FieldPassword, CodeInvalidCredentials, ErrInvalidCredentials))
+
+	return res, nil
 }
 
-func (u *UserRegistration) GetUser(email string) (*User, error) {
-	return u.userSource.Select(email)
+// rehashPassword replaces the stored hash by one of the current PasswordHasher and reports whether it did.
+func (u *UserRegistration) rehashPassword(user *User, password string) bool {
+	hashed, err := u.passwordHasher.Hash(password)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	user.Password = hashed
+
+	return true
 }
 
-func (u *UserRegistration) Confirm(code string) error {
-	decoded, err := base64.URLEncoding.DecodeString(code)
+func (u *UserRegistration) ValidateResetCode(ctx context.Context, code string) (string, error) {
+	t, _, err := u.lookupToken(ctx, TokenPurposeReset, code)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	if t == nil {
+		t, err = u.legacyResetCode(ctx, code)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	codeSplit := strings.Split(string(decoded), ":")
-	if len(codeSplit) == 1 {
-		return errors.New("invalid confirmation code")
+	if t == nil || t.UsedAt != nil || time.Now().After(t.Expiry) {
+		return "", ErrInvalidResetCode
 	}
 
-	email := codeSplit[0]
-	user, err := u.userSource.Select(email)
+	return t.Email, nil
+}
+
+func (u *UserRegistration) useResetCode(ctx context.Context, code string) error {
+	t, err := u.useToken(ctx, TokenPurposeReset, code)
+	if errors.Is(err, errTokenUsed) || errors.Is(err, errTokenExpired) {
+		return ErrInvalidResetCode
+	}
 	if err != nil {
 		return err
 	}
 
-	if user == nil {
-		return errors.New("user does not exist anymore")
+	if t != nil {
+		return nil
 	}
 
-	if user.ConfirmationCode != code {
-		return errors.New("invalid confirmation code")
+	t, err = u.legacyResetCode(ctx, code)
+	if err != nil {
+		return err
 	}
 
-	now := time.Now()
-	user.ConfirmedAt = &now
+	if t == nil || time.Now().After(t.Expiry) {
+		return ErrInvalidResetCode
+	}
 
-	return u.userSource.Update(*user)
+	return u.tokens.Delete(ctx, code)
 }
 
-func (u *UserRegistration) Forgot(email string) error {
-	if !u.HasMailSender() {
-		return errors.New("no e-mail sender configured")
+// legacyResetCode returns a reset code of earlier versions, these were stored by the code itself.
+func (u *UserRegistration) legacyResetCode(ctx context.Context, code string) (*Token, error) {
+	if code == "" || !u.legacyCodesAccepted() {
+		return nil, nil
 	}
 
-	user, err := u.GetUser(email)
+	t, err := u.tokens.Get(ctx, code)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if user != nil {
-		code, err := getCode("")
-		if err != nil {
-			return err
-		}
-		u.resetCodes[code] = resetCode{
-			Email:  email,
-			Expiry: time.Now().Add(time.Hour),
-		}
-
-		err = u.mailSender.Reset(email, code)
-		if err != nil {
-			return err
-		}
+	if t == nil || t.Purpose != tokenPurposeLegacyReset {
+		return nil, nil
 	}
 
-	return nil
+	return t, nil
 }
 
-func (u *UserRegistration) passwordError() string {
-	var errorItems []string
+func (u *UserRegistration) GetUser(ctx context.Context, email string) (*User, error) {
+	return u.selectUser(ctx, email)
+}
 
-	minLength := defaultPasswordMinLength
-	if u.passwordRequirements.MinLength != nil {
-		minLength = *u.passwordRequirements.MinLength
+func (u *UserRegistration) Confirm(ctx context.Context, code string) error {
+	t, err := u.useToken(ctx, TokenPurposeConfirm, code)
+	if errors.Is(err, errTokenExpired) {
+		return ErrConfirmationCodeExpired
+	}
+	if err != nil && !errors.Is(err, errTokenUsed) {
+		return err
 	}
-	errorItems = append(errorItems, fmt.Sprintf("at least %v characters", minLength))
 
-	maxLength := defaultPasswordMaxLength
-	if u.passwordRequirements.MaxLength != nil {
-		maxLength = *u.passwordRequirements.MaxLength
+	if t == nil {
+		return u.confirmLegacyCode(ctx, code)
 	}
-	errorItems = append(errorItems, fmt.Sprintf("at most %v characters", maxLength))
 
-	if u.passwordRequirements.MinLowers != nil {
-		errorItems = append(errorItems, fmt.Sprintf("at least %v lower case letter(s)", *u.passwordRequirements.MinLowers))
+	user, err := u.userSource.Select(ctx, t.Email)
+	if err != nil {
+		return err
 	}
 
-	if u.passwordRequirements.MinUppers != nil {
-		errorItems = append(errorItems, fmt.Sprintf("at least %v upper case letter(s)", *u.passwordRequirements.MinUppers))
+	if user == nil {
+		return ErrUserNotFound
 	}
 
-	if u.passwordRequirements.MinNumbers != nil {
-		errorItems = append(errorItems, fmt.Sprintf("at least %v number(s)", *u.passwordRequirements.MinNumbers))
+	// e.g. the link was opened twice
+	if user.ConfirmedAt != nil {
+		return nil
 	}
 
-	if u.passwordRequirements.MinSpecials != nil {
-		errorItems = append(errorItems, fmt.Sprintf("at least %v special character(s)", *u.passwordRequirements.MinSpecials))
+	// a token is replaced when a new confirmation e-mail is sent
+	if errors.Is(err, errTokenUsed) || !equalHashes(user.ConfirmationTokenHash, hashToken(code)) {
+		return ErrInvalidConfirmationCode
 	}
 
-	return fmt.Sprintf("Password does not fulfill one or more of the following requirements: %s.", strings.Join(errorItems, ", "))
+	now := time.Now()
+	user.ConfirmedAt = &now
+	user.ConfirmationTokenHash = ""
+
+	return u.userSource.Update(ctx, *user)
 }
 
-func (u *UserRegistration) verifyPassword(s string) bool {
-	minLength := defaultPasswordMinLength
-	if u.passwordRequirements.MinLength != nil {
-		minLength = *u.passwordRequirements.MinLength
-	}
-	if uint(len(s)) < minLength {
-		return false
+// confirmLegacyCode confirms with a code of earlier versions, which was stored on the user.
+func (u *UserRegistration) confirmLegacyCode(ctx context.Context, code string) error {
+	if !u.legacyCodesAccepted() {
+		return ErrInvalidConfirmationCode
 	}
 
-	maxLength := defaultPasswordMaxLength
-	if u.passwordRequirements.MaxLength != nil {
-		maxLength = *u.passwordRequirements.MaxLength
-	}
-	if uint(len(s)) > maxLength {
-		return false
-	}
-
-	if strings.Contains(s, " ") {
-		return false
+	email, err := emailFromLegacyCode(code)
+	if err != nil {
+		return ErrInvalidConfirmationCode
 	}
 
-	var lowers uint = 0
-	var uppers uint = 0
-	var numbers uint = 0
-	var specials uint = 0
-
-	for _, c := range s {
-		switch {
-		case unicode.IsNumber(c):
-			numbers++
-		case unicode.IsUpper(c):
-			uppers++
-		case unicode.IsPunct(c) || unicode.IsSymbol(c):
-			specials++
-		case unicode.IsLetter(c):
-			lowers++
-		default:
-			//return false, false, false, false
-		}
+	user, err := u.userSource.Select(ctx, email)
+	if err != nil {
+		return err
 	}
 
-	if u.passwordRequirements.MinLowers != nil {
-		if lowers < *u.passwordRequirements.MinLowers {
-			return false
-		}
+	if user == nil {
+		return ErrUserNotFound
 	}
 
-	if u.passwordRequirements.MinUppers != nil {
-		if uppers < *u.passwordRequirements.MinUppers {
-			return false
-		}
+	if user.ConfirmationCode == "" || !equalHashes(user.ConfirmationCode, code) {
+		return ErrInvalidConfirmationCode
 	}
 
-	if u.passwordRequirements.MinNumbers != nil {
-		if numbers < *u.passwordRequirements.MinNumbers {
-			return false
-		}
+	if user.ConfirmedAt != nil {
+		return nil
 	}
 
-	if u.passwordRequirements.MinSpecials != nil {
-		if specials < *u.passwordRequirements.MinSpecials {
-			return false
-		}
-	}
+	now := time.Now()
+	user.ConfirmedAt = &now
 
-	return true
+	return u.userSource.Update(ctx, *user)
 }
 
-func hashPassword(password string) (string, error) {
-	b := []byte(password)
-	var hashed []string
+func (u *UserRegistration) Forgot(ctx context.Context, email string) error {
+	if !u.HasMailSender() {
+		return errors.New("no e-mail sender configured")
+	}
 
-	for {
-		b1 := b
-		if len(b1) > maxBytesPerHash {
-			b1 = b1[:maxBytesPerHash]
-		}
-		bytes, err := bcrypt.GenerateFromPassword(b1, 14)
+	user, err := u.GetUser(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if user != nil {
+		token, _, err := u.issueToken(ctx, TokenPurposeReset, user.Email, "", resetCodeExpiry)
 		if err != nil {
-			return "", err
+			return err
 		}
 
-		hashed = append(hashed, string(bytes))
-
-		if len(b) > maxBytesPerHash {
-			b = b[maxBytesPerHash:]
-		} else {
-			break
+		err = u.mailSender.Reset(ctx, user.Address(), token)
+		if err != nil {
+			return err
 		}
 	}
 
-	return strings.Join(hashed, " "), nil
+	return nil
 }
 
-func checkPasswordHash(password, hash string) bool {
-	b := []byte(password)
+// passwordError lists the failed password requirements.
+func passwordError(failed []string) string {
+	return fmt.Sprintf("Password does not fulfill the following requirement(s): %s.", strings.Join(failed, ", "))
+}
 
-	for _, h := range strings.Split(hash, " ") {
-		if len(b) == 0 {
-			return false
+// verifyPassword returns the requirements the password of the user with the email address does
+// not fulfill, and suggestions from the failed rules that give them.
+func (u *UserRegistration) verifyPassword(s, email string) ([]string, []string) {
+	var failed []string
+	var feedback []string
+
+	for _, rule := range u.passwordRules {
+		if f, ok := rule.(passwordFeedbacker); ok {
+			ok, suggestions := f.CheckFeedback(s, email)
+			if !ok {
+				failed = append(failed, rule.Describe())
+				feedback = append(feedback, suggestions...)
+			}
+			continue
 		}
 
-		b1 := b
-		if len(b1) > maxBytesPerHash {
-			b1 = b1[:maxBytesPerHash]
-		}
-		err := bcrypt.CompareHashAndPassword([]byte(h), b1)
-		if err != nil {
-			return false
-		}
-		if len(b) > maxBytesPerHash {
-			b = b[maxBytesPerHash:]
-		} else {
-			b = []byte{}
+		if !rule.Check(s, email) {
+			failed = append(failed, rule.Describe())
 		}
 	}
 
-	return true
+	return failed, feedback
 }
@@ -1,8 +1,10 @@
 package user_registration
 
+import "context"
+
 type UserSource interface {
-	Insert(user User) error
-	Update(user User) error
-	Delete(email string) error
-	Select(email string) (*User, error)
+	Insert(ctx context.Context, user User) error
+	Update(ctx context.Context, user User) error
+	Delete(ctx context.Context, email string) error
+	Select(ctx context.Context, email string) (*User, error)
 }
@@ -2,11 +2,65 @@ package user_registration
 
 import "time"
 
+// RoleAdmin is the role of users that have every permission
+const RoleAdmin = "admin"
+
 type User struct {
-	Email            string
-	Password         string
-	ConfirmationCode string
-	CreatedAt        time.Time
-	ConfirmedAt      *time.Time
-	Properties       map[string]string
+	Email                 string // the normalized address, which is the key of the UserSource
+	DisplayEmail          string // the address as entered by the user
+	Password              string
+	PasswordHistory       []string // hashes of previous passwords, most recent first
+	PasswordChangedAt     *time.Time
+	ConfirmationCode      string // only set for users registered with earlier versions
+	ConfirmationTokenHash string
+	ConfirmationSentAt    *time.Time
+	MagicLinkSentAt       *time.Time
+	CreatedAt             time.Time
+	ConfirmedAt           *time.Time
+	ApprovalPending       bool // set for users registered while approval is required, until they are approved
+	ApprovedAt            *time.Time
+	Properties            map[string]string
+	Roles                 []string
+	Permissions           []string // granted to the user directly, apart from its roles
+	Identities            []LinkedIdentity
+	FailedLogins          uint
+	LockedUntil           *time.Time
+	TOTPSecret            string
+	TOTPEnabledAt         *time.Time
+	TOTPLastStep          int64
+	RecoveryCodes         []string
+	PendingEmail          string
+	PreviousEmail         string
+	DeletionScheduledAt   *time.Time
+	SessionVersion        uint
+}
+
+// Address returns the email address as entered by the user, which is used to send e-mails to.
+func (u User) Address() string {
+	if u.DisplayEmail != "" {
+		return u.DisplayEmail
+	}
+
+	return u.Email
+}
+
+// HasPassword reports whether the user has a password. Users created by a sign-in link or an OpenID
+// Connect login have none until they reset it.
+func (u User) HasPassword() bool {
+	return u.Password != ""
+}
+
+func (u User) HasRole(role string) bool {
+	return contains(u.Roles, role)
+}
+
+// identity returns the linked account of the OpenID Connect provider, or nil if there is none.
+func (u *User) identity(provider string) *LinkedIdentity {
+	for i := range u.Identities {
+		if u.Identities[i].Provider == provider {
+			return &u.Identities[i]
+		}
+	}
+
+	return nil
 }
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	ur "github.com/caselongo/user-registration-go/user-registration"
+	"strings"
 )
 
 type UserSource struct {
@@ -14,25 +16,25 @@ func NewUserSource() *UserSource {
 	}
 }
 
-func (u *UserSource) Insert(user ur.User) error {
+func (u *UserSource) Insert(_ context.Context, user ur.User) error {
 	u.users[user.Email] = user
 
 	return nil
 }
 
-func (u *UserSource) Update(user ur.User) error {
+func (u *UserSource) Update(_ context.Context, user ur.User) error {
 	u.users[user.Email] = user
 
 	return nil
 }
 
-func (u *UserSource) Delete(email string) error {
+func (u *UserSource) Delete(_ context.Context, email string) error {
 	delete(u.users, email)
 
 	return nil
 }
 
-func (u *UserSource) Select(email string) (*ur.User, error) {
+func (u *UserSource) Select(_ context.Context, email string) (*ur.User, error) {
 	user, ok := u.users[email]
 	if ok {
 		return &user, nil
@@ -40,3 +42,29 @@ func (u *UserSource) Select(email string) (*ur.User, error) {
 
 	return nil, nil
 }
+
+func (u *UserSource) SelectFold(_ context.Context, email string) (*ur.User, error) {
+	for key, user := range u.users {
+		if strings.EqualFold(key, email) {
+			return &user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (u *UserSource) SelectByIdentity(_ context.Context, provider, subject string) (*ur.User, error) {
+	for _, user := range u.users {
+		for _, identity := range user.Identities {
+			if identity.Provider == provider && identity.Subject == subject {
+				return &user, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func (u *UserSource) Count(_ context.Context) (int, error) {
+	return len(u.users), nil
+}